@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/andrewyang17/goBlockchain/database"
+	"github.com/andrewyang17/goBlockchain/node"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+const formatJSON = "json"
+const formatCSV = "csv"
+
+func accountCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "account",
+		Short: "Inspects accounts (history...).",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+
+	cmd.AddCommand(accountHistoryCmd())
+
+	return cmd
+}
+
+func accountHistoryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Prints every transfer in and out of an address and its mining rewards.",
+		Run: func(cmd *cobra.Command, args []string) {
+			address, _ := cmd.Flags().GetString(flagAddress)
+			format, _ := cmd.Flags().GetString(flagFormat)
+			direction, _ := cmd.Flags().GetString(flagDirection)
+			fromHeight, _ := cmd.Flags().GetUint64(flagFromHeight)
+
+			if !common.IsHexAddress(address) {
+				fmt.Fprintf(os.Stderr, "invalid address '%s'\n", address)
+				os.Exit(1)
+			}
+
+			if format != formatJSON && format != formatCSV {
+				fmt.Fprintf(os.Stderr, "unknown format '%s', must be one of: %s, %s\n", format, formatJSON, formatCSV)
+				os.Exit(1)
+			}
+
+			filter := database.AddressHistoryFilter{Direction: direction, FromHeight: fromHeight}
+			if cmd.Flags().Changed(flagToHeight) {
+				toHeight, _ := cmd.Flags().GetUint64(flagToHeight)
+				filter.ToHeight = &toHeight
+			}
+
+			state, err := database.NewStateFromDisk(getDataDirFromCmd(cmd), node.DefaultMiningDifficulty, nil)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer state.Close()
+
+			history, err := state.GetAddressHistory(database.NewAccount(address), filter)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			if format == formatJSON {
+				err = printHistoryJSON(history.Txs)
+			} else {
+				err = printHistoryCSV(history.Txs)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().String(flagAddress, "", "Address to print the history of")
+	cmd.MarkFlagRequired(flagAddress)
+	cmd.Flags().String(flagFormat, formatJSON, fmt.Sprintf("Output format: %s or %s", formatJSON, formatCSV))
+	cmd.Flags().String(flagDirection, "", fmt.Sprintf("Only entries of the direction: %s, %s or %s", database.HistoryIn, database.HistoryOut, database.HistoryReward))
+	cmd.Flags().Uint64(flagFromHeight, 0, "Only entries from the block height")
+	cmd.Flags().Uint64(flagToHeight, 0, "Only entries up to the block height, inclusive")
+
+	return cmd
+}
+
+func printHistoryJSON(txs []database.AddressTx) error {
+	txsJson, err := json.MarshalIndent(txs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(txsJson))
+
+	return nil
+}
+
+func printHistoryCSV(txs []database.AddressTx) error {
+	w := csv.NewWriter(os.Stdout)
+
+	err := w.Write([]string{"block_height", "block_hash", "index", "time", "direction", "tx_hash", "counterparty", "value", "fee"})
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range txs {
+		txHash := ""
+		if !tx.TxHash.IsEmpty() {
+			txHash = tx.TxHash.Hex()
+		}
+
+		counterparty := ""
+		if tx.Direction != database.HistoryReward {
+			counterparty = tx.Counterparty.Hex()
+		}
+
+		err := w.Write([]string{
+			strconv.FormatUint(tx.Height, 10),
+			tx.BlockHash.Hex(),
+			strconv.Itoa(tx.Index),
+			strconv.FormatUint(tx.Time, 10),
+			tx.Direction,
+			txHash,
+			counterparty,
+			strconv.FormatUint(uint64(tx.Value), 10),
+			strconv.FormatUint(uint64(tx.Fee), 10),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+
+	return w.Error()
+}
@@ -29,18 +29,41 @@ func balancesListCmd() *cobra.Command {
 		Use:   "list",
 		Short: "Lists all balances.",
 		Run: func(cmd *cobra.Command, args []string) {
-			state, err := database.NewStateFromDisk(getDataDirFromCmd(cmd), node.DefaultMiningDifficulty)
+			state, err := database.NewStateFromDisk(getDataDirFromCmd(cmd), node.DefaultMiningDifficulty, nil)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
 				os.Exit(1)
 			}
 			defer state.Close()
 
-			fmt.Printf("Account balances at %x:\n", state.LatestBlockHash())
+			accounts := database.Accounts{
+				BlockHash:     state.LatestBlockHash(),
+				Height:        state.LatestBlock().Header.Number,
+				Balances:      state.Balances,
+				Account2Nonce: state.Account2Nonce,
+				Immature:      state.ImmatureBalances(),
+			}
+
+			if cmd.Flags().Changed(flagAtHeight) {
+				height, _ := cmd.Flags().GetUint64(flagAtHeight)
+
+				accounts, err = state.AccountsAt(height)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+
+			fmt.Printf("Account balances at %x (height %d):\n", accounts.BlockHash, accounts.Height)
 			fmt.Println("-----------------")
 			fmt.Println("")
 
-			for account, balance := range state.Balances {
+			for account, balance := range accounts.Balances {
+				if immature := accounts.Immature[account]; immature > 0 {
+					fmt.Println(fmt.Sprintf("%s: %d (%d spendable, %d immature)", account.String(), balance, accounts.Spendable(account), immature))
+					continue
+				}
+
 				fmt.Println(fmt.Sprintf("%s: %d", account.String(), balance))
 			}
 
@@ -50,13 +73,14 @@ func balancesListCmd() *cobra.Command {
 			fmt.Println("-----------------")
 			fmt.Println("")
 
-			for account, nonce := range state.Account2Nonce {
+			for account, nonce := range accounts.Account2Nonce {
 				fmt.Println(fmt.Sprintf("%s: %d", account.String(), nonce))
 			}
 		},
 	}
 
 	addDefaultRequiredFlags(&cmd)
+	cmd.Flags().Uint64(flagAtHeight, 0, "Lists the balances after the block at the height instead of the latest block")
 
 	return &cmd
 }
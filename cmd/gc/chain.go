@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/andrewyang17/goBlockchain/database"
+	"github.com/andrewyang17/goBlockchain/node"
+	"github.com/spf13/cobra"
+)
+
+// chainImportProgressEvery is how often, in blocks, the import progress is printed.
+const chainImportProgressEvery = 100
+
+func chainCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "chain",
+		Short: "Moves the chain between nodes (export, import).",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+
+	cmd.AddCommand(chainExportCmd())
+	cmd.AddCommand(chainImportCmd())
+
+	return cmd
+}
+
+func chainExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Exports the main chain blocks into a portable archive.",
+		Run: func(cmd *cobra.Command, args []string) {
+			file, _ := cmd.Flags().GetString(flagFile)
+			format, _ := cmd.Flags().GetString(flagFormat)
+			from, _ := cmd.Flags().GetUint64(flagFrom)
+
+			var to *uint64
+			if cmd.Flags().Changed(flagTo) {
+				toHeight, _ := cmd.Flags().GetUint64(flagTo)
+				to = &toHeight
+			}
+
+			genesis, err := database.DataDirGenesisHash(getDataDirFromCmd(cmd))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			store, err := database.OpenBlockStore(getDataDirFromCmd(cmd), "")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer store.Close()
+
+			f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			header, err := database.ExportChain(store, genesis, f, from, to, format)
+			if err == nil {
+				err = f.Sync()
+			}
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				_ = os.Remove(file)
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Exported %d blocks, heights %d to %d, into %s\n", header.Blocks, header.From, header.To, file)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().String(flagFile, "", "Archive file to write")
+	cmd.MarkFlagRequired(flagFile)
+	cmd.Flags().String(flagFormat, database.ChainArchiveFormatGzip, fmt.Sprintf("Archive format: %s or %s (uncompressed)", database.ChainArchiveFormatGzip, database.ChainArchiveFormatJSON))
+	cmd.Flags().Uint64(flagFrom, 0, "Height of the first exported block")
+	cmd.Flags().Uint64(flagTo, 0, "Height of the last exported block, the latest block by default")
+
+	return cmd
+}
+
+func chainImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Imports and validates the blocks of an archive, resuming a previously interrupted import.",
+		Run: func(cmd *cobra.Command, args []string) {
+			file, _ := cmd.Flags().GetString(flagFile)
+
+			f, err := os.Open(file)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer f.Close()
+
+			state, err := database.NewStateFromDisk(getDataDirFromCmd(cmd), node.DefaultMiningDifficulty, nil)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer state.Close()
+
+			progress, err := database.ImportChain(state, f, func(p database.ChainImportProgress) {
+				done := p.Imported + p.Skipped
+				if done%chainImportProgressEvery == 0 || done == p.Total {
+					fmt.Printf("Import progress: %d/%d blocks, at height %d\n", done, p.Total, p.Height)
+				}
+			})
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, "Run the import again to resume it")
+				os.Exit(1)
+			}
+
+			fmt.Printf("Imported %d blocks, skipped %d already known, the chain is at height %d\n", progress.Imported, progress.Skipped, state.LatestBlock().Header.Number)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().String(flagFile, "", "Archive file to import")
+	cmd.MarkFlagRequired(flagFile)
+
+	return cmd
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/andrewyang17/goBlockchain/database"
+	"github.com/andrewyang17/goBlockchain/node"
+	"github.com/spf13/cobra"
+)
+
+func dbCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Maintains the node's database (reindex, verify, snapshot...).",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+
+	cmd.AddCommand(dbReindexCmd())
+	cmd.AddCommand(dbVerifyCmd())
+	cmd.AddCommand(dbSnapshotCmd())
+
+	return cmd
+}
+
+func dbReindexCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reindex",
+		Short: "Rebuilds the block.db hash and height indexes and the TX index.",
+		Run: func(cmd *cobra.Command, args []string) {
+			dataDir := getDataDirFromCmd(cmd)
+
+			if err := database.Reindex(dataDir); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Indexes of %s rebuilt\n", dataDir)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+
+	return cmd
+}
+
+func dbVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verifies every stored block and the block.db indexes, reporting the first invalid block.",
+		Run: func(cmd *cobra.Command, args []string) {
+			report, err := database.VerifyChain(getDataDirFromCmd(cmd), node.DefaultMiningDifficulty)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Verified %d blocks before the first error:\n", report.Blocks)
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Verified %d blocks, tip %s\n", report.Blocks, report.TipHash.Hex())
+			if !report.Indexed {
+				fmt.Println("The block.db index doesn't exist yet, it's built when the node starts")
+			}
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+
+	return cmd
+}
+
+func dbSnapshotCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Manages State snapshots (create, list, verify).",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+
+	cmd.AddCommand(dbSnapshotCreateCmd())
+	cmd.AddCommand(dbSnapshotListCmd())
+	cmd.AddCommand(dbSnapshotVerifyCmd())
+
+	return cmd
+}
+
+func dbSnapshotCreateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Creates a State snapshot at the latest block.",
+		Run: func(cmd *cobra.Command, args []string) {
+			state, err := database.NewStateFromDisk(getDataDirFromCmd(cmd), node.DefaultMiningDifficulty, nil)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer state.Close()
+
+			snapshot, err := state.CreateSnapshot()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Created snapshot at height %d, block %s\n", snapshot.Height, snapshot.Hash.Hex())
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+
+	return cmd
+}
+
+func dbSnapshotListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lists the State snapshots.",
+		Run: func(cmd *cobra.Command, args []string) {
+			snapshots, err := database.ListSnapshots(getDataDirFromCmd(cmd))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Println("State snapshots:")
+			fmt.Println("-----------------")
+			fmt.Println("")
+
+			for _, snapshot := range snapshots {
+				checksum := "ok"
+				if err := snapshot.Verify(); err != nil {
+					checksum = "invalid checksum"
+				}
+
+				fmt.Printf("%d: %s, %d accounts (%s)\n", snapshot.Height, snapshot.Hash.Hex(), len(snapshot.Balances), checksum)
+			}
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+
+	return cmd
+}
+
+func dbSnapshotVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Replays the blockchain and verifies every State snapshot.",
+		Run: func(cmd *cobra.Command, args []string) {
+			results, err := database.VerifySnapshots(getDataDirFromCmd(cmd), node.DefaultMiningDifficulty)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			heights := make([]uint64, 0, len(results))
+			for height := range results {
+				heights = append(heights, height)
+			}
+			sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+
+			isValid := true
+			for _, height := range heights {
+				if results[height] != nil {
+					isValid = false
+					fmt.Printf("%d: INVALID, %s\n", height, results[height])
+					continue
+				}
+
+				fmt.Printf("%d: ok\n", height)
+			}
+
+			if !isValid {
+				os.Exit(1)
+			}
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+
+	return cmd
+}
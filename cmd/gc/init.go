@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/andrewyang17/goBlockchain/database"
+	"github.com/spf13/cobra"
+)
+
+func initCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Initializes a data dir with a genesis file, every other command requires an initialized data dir.",
+		Run: func(cmd *cobra.Command, args []string) {
+			genesisFile, _ := cmd.Flags().GetString(flagGenesis)
+			dataDir := getDataDirFromCmd(cmd)
+
+			genesis := database.DefaultGenesisJson()
+			if genesisFile != "" {
+				content, err := ioutil.ReadFile(genesisFile)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				genesis = content
+			}
+
+			gen, err := database.ParseGenesis(genesis)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			// The chain name and ID are opt-in, the default genesis and its hash stay the same without them
+			if cmd.Flags().Changed(flagChainName) || cmd.Flags().Changed(flagChainID) {
+				if cmd.Flags().Changed(flagChainName) {
+					gen.ChainName, _ = cmd.Flags().GetString(flagChainName)
+				}
+
+				if cmd.Flags().Changed(flagChainID) {
+					gen.ChainID, _ = cmd.Flags().GetUint64(flagChainID)
+				}
+
+				genesis, err = json.MarshalIndent(gen, "", "  ")
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+
+			if err := database.InitDataDir(dataDir, genesis); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			hash, err := gen.Hash()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Initialized %s with chain '%s' (ID %d), genesis %s\n", dataDir, gen.ChainName, gen.ChainID, hash.Hex())
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().String(flagGenesis, "", "Path to the genesis JSON file, the GoCoin genesis by default")
+	cmd.Flags().String(flagChainName, "", "Chain name overriding the genesis one")
+	cmd.Flags().Uint64(flagChainID, 0, "Chain ID overriding the genesis one, TXs are signed for it since TIP4 fork")
+
+	return cmd
+}
@@ -16,6 +16,21 @@ const flagPort = "port"
 const flagBootstrapAcc = "bootstrap-account"
 const flagBootstrapIP = "bootstrap-ip"
 const flagBootstrapPort = "bootstrap-port"
+const flagDBEngine = "db-engine"
+const flagRewardSplit = "reward-split"
+const flagMaxFutureDrift = "max-future-drift"
+const flagAddress = "address"
+const flagFormat = "format"
+const flagDirection = "direction"
+const flagFromHeight = "from-height"
+const flagToHeight = "to-height"
+const flagAtHeight = "at-height"
+const flagFrom = "from"
+const flagTo = "to"
+const flagFile = "file"
+const flagGenesis = "genesis"
+const flagChainName = "chain-name"
+const flagChainID = "chain-id"
 
 func main() {
 	cmd := &cobra.Command{
@@ -25,9 +40,13 @@ func main() {
 	}
 
 	cmd.AddCommand(versionCmd)
+	cmd.AddCommand(initCmd())
 	cmd.AddCommand(walletCmd())
 	cmd.AddCommand(runCmd())
 	cmd.AddCommand(balanceCmd())
+	cmd.AddCommand(accountCmd())
+	cmd.AddCommand(chainCmd())
+	cmd.AddCommand(dbCmd())
 
 	if err := cmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -4,9 +4,12 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/andrewyang17/goBlockchain/database"
 	"github.com/andrewyang17/goBlockchain/node"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/spf13/cobra"
 )
 
@@ -22,6 +25,15 @@ func runCmd() *cobra.Command {
 			bootstrapIP, _ := cmd.Flags().GetString(flagBootstrapIP)
 			bootstrapPort, _ := cmd.Flags().GetUint64(flagBootstrapPort)
 			bootstrapAcc, _ := cmd.Flags().GetString(flagBootstrapAcc)
+			dbEngine, _ := cmd.Flags().GetString(flagDBEngine)
+			rewardSplit, _ := cmd.Flags().GetString(flagRewardSplit)
+			maxFutureDrift, _ := cmd.Flags().GetUint64(flagMaxFutureDrift)
+
+			rewardShares, err := parseRewardShares(rewardSplit)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
 
 			fmt.Println("Launching Blockchain node and its HTTP API...")
 
@@ -34,6 +46,9 @@ func runCmd() *cobra.Command {
 			)
 
 			n := node.New(getDataDirFromCmd(cmd), ip, port, database.NewAccount(miner), bootstrap, node.DefaultMiningDifficulty)
+			n.ChangeDBEngine(dbEngine)
+			n.ChangeRewardShares(rewardShares)
+			n.ChangeMaxFutureDrift(maxFutureDrift)
 
 			if err := n.Run(context.Background()); err != nil {
 				fmt.Println(err)
@@ -51,5 +66,42 @@ func runCmd() *cobra.Command {
 	cmd.Flags().Uint64(flagBootstrapPort, node.DefaultBootstrapPort, "default bootstrap server port to interconnect peers")
 	cmd.Flags().String(flagBootstrapAcc, node.DefaultBootstrapAcc, "default bootstrap account to interconnect peers")
 
+	cmd.Flags().String(flagDBEngine, "", fmt.Sprintf("blocks storage engine, '%s' or '%s' (default: the data dir's engine, '%s' for new ones)", database.FileDBEngine, database.LevelDBEngine, database.FileDBEngine))
+
+	cmd.Flags().String(flagRewardSplit, "", "block reward beneficiaries since TIP7 fork, as 'account:weight,...' (default: the miner account)")
+	cmd.Flags().Uint64(flagMaxFutureDrift, node.DefaultMaxFutureBlockDrift, "seconds a synced block can be ahead of the node time, later blocks are deferred")
+
 	return &cmd
 }
+
+// parseRewardShares parses the reward beneficiaries, e.g. "0xabc...:3,0xdef...:1" pays 3/4 of the reward to 0xabc...
+func parseRewardShares(value string) ([]database.RewardShare, error) {
+	shares := make([]database.RewardShare, 0)
+	if strings.TrimSpace(value) == "" {
+		return shares, nil
+	}
+
+	seen := make(map[string]struct{})
+
+	for _, part := range strings.Split(value, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		if len(fields) != 2 || !common.IsHexAddress(fields[0]) {
+			return nil, fmt.Errorf("invalid --%s '%s', must be 'account:weight'", flagRewardSplit, part)
+		}
+
+		weight, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil || weight == 0 {
+			return nil, fmt.Errorf("invalid --%s weight '%s', must be a positive number", flagRewardSplit, fields[1])
+		}
+
+		account := database.NewAccount(fields[0])
+		if _, ok := seen[account.Hex()]; ok {
+			return nil, fmt.Errorf("invalid --%s, account '%s' is listed twice", flagRewardSplit, account.Hex())
+		}
+		seen[account.Hex()] = struct{}{}
+
+		shares = append(shares, database.RewardShare{Account: account, Weight: uint(weight)})
+	}
+
+	return shares, nil
+}
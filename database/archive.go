@@ -0,0 +1,213 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ChainArchiveVersion is bumped whenever the chain archive layout changes.
+const ChainArchiveVersion = 1
+
+const ChainArchiveFormatGzip = "gzip"
+const ChainArchiveFormatJSON = "json"
+
+var errStopExport = errors.New("stop export")
+
+// ChainArchiveHeader is the first line of a chain archive, followed by one block.db record per block.
+type ChainArchiveHeader struct {
+	Version int    `json:"version"`
+	From    uint64 `json:"from"`
+	To      uint64 `json:"to"`
+	Blocks  uint64 `json:"blocks"`
+	Genesis Hash   `json:"genesis"`
+}
+
+// ChainImportProgress reports how far a chain archive import got.
+type ChainImportProgress struct {
+	Height uint64 `json:"height"`
+
+	// Imported blocks went through State.AddBlock, Skipped ones were already part of the main chain
+	Imported uint64 `json:"imported"`
+	Skipped  uint64 `json:"skipped"`
+	Total    uint64 `json:"total"`
+}
+
+// ExportChain writes the main chain blocks from height from to height to, inclusive, as a chain archive
+// of the chain with the given genesis hash, in the given format. A nil to exports up to the latest block.
+//
+// The blocks are stored as checksummed block.db records, so a damaged archive is detected by ImportChain.
+func ExportChain(store BlockStore, genesis Hash, w io.Writer, from uint64, to *uint64, format string) (ChainArchiveHeader, error) {
+	header := ChainArchiveHeader{Version: ChainArchiveVersion, From: from, Genesis: genesis}
+
+	if to != nil && *to < from {
+		return header, fmt.Errorf("invalid height range %d-%d", from, *to)
+	}
+
+	var out io.Writer
+	var zw *gzip.Writer
+
+	switch format {
+	case ChainArchiveFormatGzip:
+		zw = gzip.NewWriter(w)
+		out = zw
+	case ChainArchiveFormatJSON:
+		out = w
+	default:
+		return header, fmt.Errorf("unknown chain archive format '%s', must be one of: %s, %s", format, ChainArchiveFormatGzip, ChainArchiveFormatJSON)
+	}
+
+	// The header states the number of blocks, count them before writing anything
+	err := store.Iterate(from, func(blockFs BlockFS) error {
+		if to != nil && blockFs.Value.Header.Number > *to {
+			return errStopExport
+		}
+
+		header.To = blockFs.Value.Header.Number
+		header.Blocks++
+
+		return nil
+	})
+	if err != nil && err != errStopExport {
+		return header, err
+	}
+
+	if header.Blocks == 0 {
+		return header, fmt.Errorf("no main chain blocks from height %d", from)
+	}
+
+	bw := bufio.NewWriter(out)
+
+	headerJson, err := json.Marshal(header)
+	if err != nil {
+		return header, err
+	}
+
+	if _, err := bw.Write(append(headerJson, '\n')); err != nil {
+		return header, err
+	}
+
+	err = store.Iterate(from, func(blockFs BlockFS) error {
+		if blockFs.Value.Header.Number > header.To {
+			return errStopExport
+		}
+
+		record, err := encodeBlockRecord(blockFs)
+		if err != nil {
+			return err
+		}
+
+		_, err = bw.Write(record)
+
+		return err
+	})
+	if err != nil && err != errStopExport {
+		return header, err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return header, err
+	}
+
+	if zw != nil {
+		return header, zw.Close()
+	}
+
+	return header, nil
+}
+
+// ImportChain adds the blocks of a chain archive to the State through the full AddBlock validation,
+// calling progress, if set, after each block.
+//
+// Blocks already part of the main chain are skipped, so an interrupted import is resumed by importing
+// the same archive again. The archive format is detected from its content. An archive of another chain,
+// a different genesis hash, is rejected before any block is imported.
+func ImportChain(state *State, r io.Reader, progress func(ChainImportProgress)) (ChainImportProgress, error) {
+	var p ChainImportProgress
+
+	if progress == nil {
+		progress = func(ChainImportProgress) {}
+	}
+
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(2)
+	if err != nil {
+		return p, fmt.Errorf("invalid chain archive: %w", err)
+	}
+
+	var in io.Reader = br
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return p, fmt.Errorf("invalid chain archive: %w", err)
+		}
+		defer zr.Close()
+
+		in = zr
+	}
+
+	reader := bufio.NewReader(in)
+
+	headerJson, err := reader.ReadBytes('\n')
+	if err != nil {
+		return p, fmt.Errorf("invalid chain archive header: %w", err)
+	}
+
+	var header ChainArchiveHeader
+	if err := json.Unmarshal(headerJson, &header); err != nil {
+		return p, fmt.Errorf("invalid chain archive header: %w", err)
+	}
+
+	if header.Version < 1 || header.Version > ChainArchiveVersion {
+		return p, fmt.Errorf("unsupported chain archive version %d, the latest supported is %d", header.Version, ChainArchiveVersion)
+	}
+
+	if header.Genesis != state.GenesisHash() {
+		return p, fmt.Errorf("chain archive of genesis '%x' can't be imported into the chain of genesis '%x'", header.Genesis, state.GenesisHash())
+	}
+
+	p.Total = header.Blocks
+
+	for p.Imported+p.Skipped < header.Blocks {
+		record, err := reader.ReadBytes('\n')
+		if err != nil {
+			return p, fmt.Errorf("chain archive ends after %d of %d blocks: %w", p.Imported+p.Skipped, header.Blocks, err)
+		}
+
+		blockFs, err := decodeBlockRecord(record)
+		if err != nil {
+			return p, fmt.Errorf("corrupt chain archive record after height %d: %w", p.Height, err)
+		}
+
+		p.Height = blockFs.Value.Header.Number
+
+		hash, err := blockFs.Value.Hash()
+		if err != nil {
+			return p, err
+		}
+
+		if hash != blockFs.Key {
+			return p, fmt.Errorf("archived block %d hash '%x' doesn't match its content hash '%x'", p.Height, blockFs.Key, hash)
+		}
+
+		if p.Height < state.NextBlockNumber() && state.IsMainChainBlock(blockFs.Key) {
+			p.Skipped++
+			progress(p)
+			continue
+		}
+
+		if _, err := state.AddBlock(blockFs.Value); err != nil {
+			return p, fmt.Errorf("importing block %d: %w", p.Height, err)
+		}
+
+		p.Imported++
+		progress(p)
+	}
+
+	return p, nil
+}
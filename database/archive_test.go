@@ -0,0 +1,196 @@
+package database
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestChainArchive_ExportImport(t *testing.T) {
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+	genesisBalances := map[common.Address]uint{miner: 1000}
+
+	srcDir := setupTestDataDir(t, genesisBalances)
+	defer os.RemoveAll(srcDir)
+
+	src, err := NewStateFromDisk(srcDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	parent := Hash{}
+	for i := uint64(0); i < 10; i++ {
+		parent = addTestBlock(t, src, mineTestBlock(t, parent, i, miner, nil))
+	}
+
+	for _, format := range []string{ChainArchiveFormatGzip, ChainArchiveFormatJSON} {
+		var archive bytes.Buffer
+
+		header, err := ExportChain(src.store, src.GenesisHash(), &archive, 0, nil, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if header.Blocks != 10 || header.To != 9 {
+			t.Fatalf("%s archive must hold blocks 0 to 9, got %+v", format, header)
+		}
+
+		dstDir := setupTestDataDir(t, genesisBalances)
+		defer os.RemoveAll(dstDir)
+
+		dst, err := NewStateFromDisk(dstDir, testMiningDifficulty, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dst.Close()
+
+		// Interrupt the import halfway through the archive
+		half := archive.Bytes()[:archive.Len()/2]
+		if _, err := ImportChain(dst, bytes.NewReader(half), nil); err == nil {
+			t.Fatalf("truncated %s archive must fail to import", format)
+		}
+
+		if format == ChainArchiveFormatJSON && dst.NextBlockNumber() == 0 {
+			t.Fatalf("blocks before the truncation must be imported")
+		}
+		resumeFrom := dst.NextBlockNumber()
+
+		var reported []ChainImportProgress
+		progress, err := ImportChain(dst, bytes.NewReader(archive.Bytes()), func(p ChainImportProgress) {
+			reported = append(reported, p)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if progress.Skipped != resumeFrom || progress.Imported != 10-resumeFrom || len(reported) != 10 {
+			t.Fatalf("import must resume at height %d, got %+v with %d progress reports", resumeFrom, progress, len(reported))
+		}
+
+		if dst.LatestBlockHash() != src.LatestBlockHash() || dst.Balances[miner] != src.Balances[miner] {
+			t.Fatalf("imported %s chain must match the exported one", format)
+		}
+	}
+
+	// Import the first blocks of a range export, then a tampered archive of the following ones
+	dstDir := setupTestDataDir(t, genesisBalances)
+	defer os.RemoveAll(dstDir)
+
+	dst, err := NewStateFromDisk(dstDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	to := uint64(4)
+
+	var archive bytes.Buffer
+	if _, err := ExportChain(src.store, src.GenesisHash(), &archive, 0, &to, ChainArchiveFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ImportChain(dst, &archive, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	archive.Reset()
+	header, err := ExportChain(src.store, src.GenesisHash(), &archive, 5, nil, ChainArchiveFormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if header.Blocks != 5 || header.From != 5 || header.To != 9 {
+		t.Fatalf("archive must hold blocks 5 to 9, got %+v", header)
+	}
+
+	tampered := bytes.Replace(archive.Bytes(), []byte(`"number":6`), []byte(`"number":8`), 1)
+
+	if _, err := ImportChain(dst, bytes.NewReader(tampered), nil); err == nil {
+		t.Fatalf("tampered archive must fail to import")
+	}
+
+	if dst.LatestBlock().Header.Number != 5 {
+		t.Fatalf("blocks before the tampered one must be imported, the chain is at height %d", dst.LatestBlock().Header.Number)
+	}
+
+	// An archive of another chain is rejected upfront
+	otherDir := setupTestDataDir(t, map[common.Address]uint{miner: 2000})
+	defer os.RemoveAll(otherDir)
+
+	other, err := NewStateFromDisk(otherDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	archive.Reset()
+	if _, err := ExportChain(src.store, src.GenesisHash(), &archive, 0, nil, ChainArchiveFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	progress, err := ImportChain(other, &archive, nil)
+	if err == nil || progress.Imported != 0 || other.NextBlockNumber() != 0 {
+		t.Fatalf("archive of another genesis must be rejected before importing any block, got %+v, error: %v", progress, err)
+	}
+}
+
+func TestChainArchive_ChainFromHeightOne(t *testing.T) {
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+	genesisBalances := map[common.Address]uint{miner: 1000}
+
+	srcDir := setupTestDataDir(t, genesisBalances)
+	defer os.RemoveAll(srcDir)
+
+	src, err := NewStateFromDisk(srcDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	// The node numbers its first mined block 1
+	parent := Hash{}
+	for i := uint64(1); i <= 3; i++ {
+		parent = addTestBlock(t, src, mineTestBlock(t, parent, i, miner, nil))
+	}
+
+	var archive bytes.Buffer
+
+	header, err := ExportChain(src.store, src.GenesisHash(), &archive, 0, nil, ChainArchiveFormatGzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if header.Blocks != 3 || header.To != 3 {
+		t.Fatalf("archive must hold blocks 1 to 3, got %+v", header)
+	}
+
+	dstDir := setupTestDataDir(t, genesisBalances)
+	defer os.RemoveAll(dstDir)
+
+	dst, err := NewStateFromDisk(dstDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	progress, err := ImportChain(dst, bytes.NewReader(archive.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if progress.Imported != 3 || dst.LatestBlockHash() != src.LatestBlockHash() || dst.Balances[miner] != src.Balances[miner] {
+		t.Fatalf("imported chain must match the exported one, got %+v", progress)
+	}
+
+	progress, err = ImportChain(dst, bytes.NewReader(archive.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if progress.Skipped != 3 || progress.Imported != 0 {
+		t.Fatalf("importing the same archive again must skip every block, got %+v", progress)
+	}
+}
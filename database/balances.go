@@ -0,0 +1,102 @@
+package database
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Accounts are the account balances and nonces after a main chain block.
+type Accounts struct {
+	BlockHash     Hash                    `json:"block_hash"`
+	Height        uint64                  `json:"block_height"`
+	Balances      map[common.Address]uint `json:"balances"`
+	Account2Nonce map[common.Address]uint `json:"account_2_nonce"`
+
+	// Immature balances are the part of Balances locked until the CoinbaseMaturity
+	Immature map[common.Address]uint `json:"immature_balances"`
+}
+
+// Spendable returns the account balance the next block can spend.
+func (a Accounts) Spendable(account common.Address) uint {
+	return a.Balances[account] - a.Immature[account]
+}
+
+// AccountsAt returns the account balances and nonces after the main chain block at the given height.
+//
+// The recent heights are rolled back from the latest block. Older ones are rebuilt from the closest snapshot
+// below them and the accountsDiff of the blocks since, without applying the blocks again.
+func (s *State) AccountsAt(height uint64) (Accounts, error) {
+	past, err := s.stateAt(height)
+	if err != nil {
+		return Accounts{}, err
+	}
+
+	return Accounts{
+		BlockHash:     past.latestBlockHash,
+		Height:        past.latestBlock.Header.Number,
+		Balances:      past.Balances,
+		Account2Nonce: past.Account2Nonce,
+		Immature:      past.ImmatureBalances(),
+	}, nil
+}
+
+// BalanceAt returns the account balance and nonce after the main chain block at the given height.
+func (s *State) BalanceAt(account common.Address, height uint64) (uint, uint, error) {
+	accounts, err := s.AccountsAt(height)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return accounts.Balances[account], accounts.Account2Nonce[account], nil
+}
+
+// accountsDiff is the account values a main chain block changed, as they are after it, with the rewards
+// still immature after it. The diffs are kept in the TX index to move a past State forward without applying
+// the blocks again.
+type accountsDiff struct {
+	BlockHash     Hash                    `json:"block_hash"`
+	Balances      map[common.Address]uint `json:"balances"`
+	Account2Nonce map[common.Address]uint `json:"account_2_nonce"`
+	Immature      []ImmatureReward        `json:"immature"`
+}
+
+// newAccountsDiff returns the diff of the block the undo reverts, from the State after it.
+func newAccountsDiff(blockHash Hash, undo accountsUndo, after *State) accountsDiff {
+	diff := accountsDiff{
+		BlockHash:     blockHash,
+		Balances:      make(map[common.Address]uint),
+		Account2Nonce: make(map[common.Address]uint),
+		Immature:      after.immature,
+	}
+
+	for acc := range undo.balances {
+		diff.Balances[acc] = after.Balances[acc]
+	}
+
+	for _, acc := range undo.newBalances {
+		diff.Balances[acc] = after.Balances[acc]
+	}
+
+	for acc := range undo.nonces {
+		diff.Account2Nonce[acc] = after.Account2Nonce[acc]
+	}
+
+	for _, acc := range undo.newNonces {
+		diff.Account2Nonce[acc] = after.Account2Nonce[acc]
+	}
+
+	return diff
+}
+
+func (d accountsDiff) apply(s *State) {
+	for acc, balance := range d.Balances {
+		s.Balances[acc] = balance
+		s.accountChanged(acc)
+	}
+
+	for acc, nonce := range d.Account2Nonce {
+		s.Account2Nonce[acc] = nonce
+		s.accountChanged(acc)
+	}
+
+	s.immature = d.Immature
+}
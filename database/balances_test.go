@@ -0,0 +1,108 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestState_AccountsAt(t *testing.T) {
+	senderKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(senderKey.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+
+	dataDir := setupTestDataDir(t, map[common.Address]uint{sender: 1000})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+	state.snapshotInterval = 5
+
+	// Every block sends 1 token more than its height to the receiver
+	hashes := make([]Hash, 0)
+	parent := Hash{}
+	for i := uint64(0); i < 12; i++ {
+		tx := signTestTx(t, NewBaseTx(sender, receiver, uint(i+1), uint(i+1), ""), senderKey)
+		parent = addTestBlock(t, state, mineTestBlock(t, parent, i, miner, []SignedTx{tx}))
+		hashes = append(hashes, parent)
+	}
+
+	// The recent heights are rolled back from the latest block
+	rolledBack := make(map[uint64]Accounts)
+
+	for _, height := range []uint64{0, 4, 5, 7, 11} {
+		accounts, err := state.AccountsAt(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rolledBack[height] = accounts
+
+		if accounts.BlockHash != hashes[height] || accounts.Height != height {
+			t.Fatalf("accounts at height %d must be after block '%x', got '%x' at %d", height, hashes[height], accounts.BlockHash, accounts.Height)
+		}
+
+		n := uint(height + 1)
+		expectedReceived := n * (n + 1) / 2
+
+		balance, nonce, err := state.BalanceAt(receiver, height)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if balance != expectedReceived || nonce != 0 {
+			t.Errorf("receiver balance at height %d must be %d, got %d", height, expectedReceived, balance)
+		}
+
+		if accounts.Account2Nonce[sender] != n {
+			t.Errorf("sender nonce at height %d must be %d, got %d", height, n, accounts.Account2Nonce[sender])
+		}
+
+		if accounts.Balances[miner] != n*BlockReward+n*TxGas*TxGasPriceDefault {
+			t.Errorf("miner balance at height %d must include %d rewards, got %d", height, n, accounts.Balances[miner])
+		}
+	}
+
+	if _, err := state.AccountsAt(12); err == nil {
+		t.Fatalf("accounts above the latest block must not be returned")
+	}
+
+	if state.Balances[receiver] != 78 {
+		t.Errorf("querying past accounts must leave the State untouched, receiver balance is %d", state.Balances[receiver])
+	}
+
+	if err := state.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once reopened, the older heights are rebuilt from the snapshots and the persisted diffs
+	state, err = NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	for height, expected := range rolledBack {
+		if _, err := state.txIndex.accountsDiff(height); err != nil {
+			t.Fatalf("diff of block %d must be persisted: %s", height, err)
+		}
+
+		accounts, err := state.AccountsAt(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if accounts.BlockHash != expected.BlockHash || !equalAccounts(accounts.Balances, expected.Balances) ||
+			!equalAccounts(accounts.Account2Nonce, expected.Account2Nonce) || !equalAccounts(accounts.Immature, expected.Immature) {
+			t.Errorf("rebuilt accounts at height %d must be the rolled back ones %+v, got %+v", height, expected, accounts)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"sort"
+)
+
+// InitialBaseFee is the base fee of the first TIP11 block.
+const InitialBaseFee = TxGasPriceDefault
+
+// MinBaseFee is the lowest base fee, so every TX burns some of its fee.
+const MinBaseFee = 1
+
+// ElasticityMultiplier divides the block gas limit into the gas target, the block gas the base fee doesn't move at.
+const ElasticityMultiplier = 2
+
+// BaseFeeChangeDenominator bounds the base fee change of a single block to 1/8, reached by empty and full blocks.
+const BaseFeeChangeDenominator = 8
+
+// feeHistoryBlocks is the number of latest blocks the suggested tip is sampled from.
+const feeHistoryBlocks = 20
+
+// FeeEstimate suggests the fees of a TX to be included in the next block.
+type FeeEstimate struct {
+	BlockNumber uint64 `json:"block_number"`
+	Gas         uint   `json:"gas"`
+
+	// BaseFee of the next block, burned. 0 before TIP11 fork.
+	BaseFee uint `json:"base_fee"`
+
+	// Tip and MaxFee per gas since TIP11 fork. The max fee covers the base fee increases of a few full blocks.
+	Tip    uint `json:"tip"`
+	MaxFee uint `json:"max_fee"`
+
+	// GasPrice before TIP11 fork
+	GasPrice uint `json:"gas_price"`
+}
+
+// NextBaseFee returns the base fee per gas the next block commits since TIP11 fork, 0 before.
+//
+// The base fee goes up when the parent block used more gas than the gas target, half of the block gas limit,
+// and down when it used less, by at most 1/BaseFeeChangeDenominator.
+func (s *State) NextBaseFee() uint {
+	if !s.config.Rules(s.NextBlockNumber()).IsTIP11 {
+		return 0
+	}
+
+	parent := s.latestBlock
+	if !s.hasGenesisBlock || parent.Header.BaseFee == 0 {
+		return InitialBaseFee
+	}
+
+	return calcBaseFee(parent.Header.BaseFee, parent.GasUsed(), s.config.BlockGasLimit/ElasticityMultiplier)
+}
+
+// calcBaseFee moves the parent base fee in proportion to how far the parent gas used is from the gas target.
+func calcBaseFee(parentBaseFee uint, gasUsed uint, gasTarget uint) uint {
+	if gasTarget == 0 || gasUsed == gasTarget {
+		return parentBaseFee
+	}
+
+	if gasUsed > gasTarget {
+		delta := parentBaseFee * (gasUsed - gasTarget) / gasTarget / BaseFeeChangeDenominator
+		if delta < 1 {
+			delta = 1
+		}
+
+		return parentBaseFee + delta
+	}
+
+	delta := parentBaseFee * (gasTarget - gasUsed) / gasTarget / BaseFeeChangeDenominator
+	if parentBaseFee-delta < MinBaseFee {
+		return MinBaseFee
+	}
+
+	return parentBaseFee - delta
+}
+
+// EstimateFees suggests the fees of a TX for the next block, the tip being the median tip per gas
+// the TXs of the latest blocks paid, at least TxGasPriceDefault.
+func (s *State) EstimateFees() FeeEstimate {
+	rules := s.Rules()
+
+	tips := make([]uint, 0)
+
+	from := 0
+	if len(s.mainChain) > feeHistoryBlocks {
+		from = len(s.mainChain) - feeHistoryBlocks
+	}
+
+	for _, cb := range s.mainChain[from:] {
+		for _, tx := range cb.block.Txs {
+			if tx.IsReward() || tx.Gas == 0 {
+				continue
+			}
+
+			tips = append(tips, tx.TipAt(cb.block.Header.BaseFee)/tx.Gas)
+		}
+	}
+
+	tip := uint(TxGasPriceDefault)
+	if len(tips) > 0 {
+		sort.Slice(tips, func(i, j int) bool {
+			return tips[i] < tips[j]
+		})
+
+		if median := tips[len(tips)/2]; median > tip {
+			tip = median
+		}
+	}
+
+	estimate := FeeEstimate{
+		BlockNumber: rules.Number,
+		Gas:         TxGas,
+	}
+
+	if rules.IsTIP11 {
+		estimate.BaseFee = rules.BaseFee
+		estimate.Tip = tip
+		estimate.MaxFee = 2*rules.BaseFee + tip
+	} else if rules.IsTIP1 {
+		estimate.GasPrice = tip
+	} else {
+		estimate.Gas = 0
+	}
+
+	return estimate
+}
+
+// txCost returns the TX value with the fee the sender pays under the rules of a block.
+func txCost(tx SignedTx, rules Rules) uint {
+	if rules.IsTIP11 {
+		return tx.Value + tx.FeeAt(rules.BaseFee)
+	}
+
+	return tx.Cost(rules.IsTIP1)
+}
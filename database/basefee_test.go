@@ -0,0 +1,127 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestCalcBaseFee(t *testing.T) {
+	tests := []struct {
+		parentBaseFee uint
+		gasUsed       uint
+		baseFee       uint
+	}{
+		{8, 100, 8},
+		{8, 200, 9},
+		{8, 0, 7},
+		{100, 200, 112},
+		{100, 0, 88},
+		// The base fee always goes up above the gas target and never below the MinBaseFee
+		{1, 101, 2},
+		{1, 0, MinBaseFee},
+	}
+
+	for _, tc := range tests {
+		if baseFee := calcBaseFee(tc.parentBaseFee, tc.gasUsed, 100); baseFee != tc.baseFee {
+			t.Errorf("base fee after %d with %d gas used must be %d, got %d", tc.parentBaseFee, tc.gasUsed, tc.baseFee, baseFee)
+		}
+	}
+}
+
+func TestTx_EffectiveGasPrice(t *testing.T) {
+	tx := Tx{Gas: TxGas, MaxFee: 10, Tip: 2}
+
+	if price := tx.EffectiveGasPrice(5); price != 7 || tx.TipAt(5) != 2*TxGas || tx.FeeAt(5) != 7*TxGas {
+		t.Fatalf("TX must pay the base fee with the tip, got %d", price)
+	}
+
+	if price := tx.EffectiveGasPrice(9); price != 10 || tx.TipAt(9) != TxGas {
+		t.Fatalf("TX must pay at most its max fee, got %d", price)
+	}
+
+	legacy := Tx{Gas: TxGas, GasPrice: 3}
+	if legacy.EffectiveGasPrice(0) != 3 || legacy.TipAt(0) != legacy.GasCost() {
+		t.Fatalf("TX without a max fee must pay its gas price")
+	}
+}
+
+func TestState_BaseFeeFork(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+
+	// The gas target is a single TX
+	dataDir := setupTestDataDirWithGenesis(t, Genesis{
+		Balances:      map[common.Address]uint{sender: 1000},
+		BlockGasLimit: 2 * TxGas,
+		Forks:         map[string]uint64{ForkTIP10: 0, ForkTIP11: 1},
+	})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	mineBlock := func(parent Hash, number uint64, txs []SignedTx, baseFee uint) Block {
+		b := NewBlock(parent, number, 0, 1650000000+number, miner, txs)
+		b.Header.BaseFee = baseFee
+
+		return mineTestPreparedBlock(t, b)
+	}
+
+	if _, err := state.AddBlock(mineBlock(Hash{}, 0, nil, InitialBaseFee)); err == nil {
+		t.Fatal("block committing a base fee before TIP11 must be rejected")
+	}
+
+	b0Hash := addTestBlock(t, state, mineTestBlock(t, Hash{}, 0, miner, nil))
+
+	if baseFee := state.NextBaseFee(); baseFee != InitialBaseFee {
+		t.Fatalf("first TIP11 block base fee must be %d, got %d", InitialBaseFee, baseFee)
+	}
+
+	legacy := signTestTx(t, NewBaseTx(sender, receiver, 10, 1, ""), key)
+	if err := ValidateTx(legacy, state); err == nil {
+		t.Fatal("TX paying a gas price must be rejected since TIP11")
+	}
+
+	tx1 := signTestTx(t, Tx{From: sender, To: receiver, Gas: TxGas, MaxFee: 5, Tip: 2, Value: 10, Nonce: 1, Time: 1}, key)
+	tx2 := signTestTx(t, Tx{From: sender, To: receiver, Gas: TxGas, MaxFee: 5, Tip: 2, Value: 10, Nonce: 2, Time: 2}, key)
+
+	if _, err := state.AddBlock(mineTestBlock(t, b0Hash, 1, miner, []SignedTx{tx1, tx2})); err == nil {
+		t.Fatal("block without the base fee must be rejected since TIP11")
+	}
+
+	addTestBlock(t, state, mineBlock(b0Hash, 1, []SignedTx{tx1, tx2}, InitialBaseFee))
+
+	// Both TXs pay the base fee with the tip, the miner earns the tips only
+	if balance := state.Balances[sender]; balance != 1000-2*(10+3*TxGas) {
+		t.Fatalf("sender must pay the base fee and tip of both TXs, got %d", balance)
+	}
+
+	if balance := state.Balances[miner]; balance != 2*BlockReward+2*2*TxGas {
+		t.Fatalf("miner must earn the tips, got %d", balance)
+	}
+
+	if burned := state.Supply().Burned; burned != 2*TxGas*InitialBaseFee {
+		t.Fatalf("base fee of both TXs must be burned, got %d", burned)
+	}
+
+	// The block used twice the gas target
+	if baseFee := state.NextBaseFee(); baseFee != InitialBaseFee+1 {
+		t.Fatalf("base fee must go up after a full block, got %d", baseFee)
+	}
+
+	estimate := state.EstimateFees()
+	if estimate.BaseFee != 2 || estimate.Tip != 2 || estimate.MaxFee != 6 || estimate.GasPrice != 0 {
+		t.Fatalf("unexpected fee estimate %+v", estimate)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
-	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -39,6 +38,21 @@ type BlockHeader struct {
 	Nonce  uint32         `json:"nonce"`
 	Time   uint64         `json:"time"`
 	Miner  common.Address `json:"miner"`
+
+	// TxRoot is the Merkle root of the block TXs, committed since TIP2 fork
+	TxRoot *Hash `json:"tx_root,omitempty"`
+
+	// StateRoot is the root of the account balances and nonces tree after the block, committed since TIP3 fork
+	StateRoot *Hash `json:"state_root,omitempty"`
+
+	// Difficulty the block is mined with, committed since TIP5 fork, see State.NextDifficulty
+	Difficulty uint `json:"difficulty,omitempty"`
+
+	// Bits is the compact PoW target the block hash meets, replacing the Difficulty since TIP6 fork, see State.NextBits
+	Bits uint32 `json:"bits,omitempty"`
+
+	// BaseFee per gas burned by the block TXs, committed since TIP11 fork, see State.NextBaseFee
+	BaseFee uint `json:"base_fee,omitempty"`
 }
 
 type Block struct {
@@ -64,7 +78,13 @@ func NewBlock(parent Hash, number uint64, nonce uint32, time uint64, miner commo
 	}
 }
 
+// Hash of blocks committing their TXs Merkle root covers only the header, so the PoW
+// can be verified without the TXs. Prior TIP2 the whole block is hashed.
 func (b Block) Hash() (Hash, error) {
+	if b.Header.TxRoot != nil {
+		return b.Header.Hash()
+	}
+
 	blockJson, err := json.Marshal(b)
 	if err != nil {
 		return Hash{}, err
@@ -73,28 +93,58 @@ func (b Block) Hash() (Hash, error) {
 	return sha256.Sum256(blockJson), nil
 }
 
-func (b Block) GasReward() uint {
+func (h BlockHeader) Hash() (Hash, error) {
+	headerJson, err := json.Marshal(h)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	return sha256.Sum256(headerJson), nil
+}
+
+// CommitTxs sorts the TXs the way the State applies them before TIP8 fork and commits their Merkle root in the header.
+func (b *Block) CommitTxs() error {
+	SortTxs(b.Txs)
+
+	return b.CommitTxRoot()
+}
+
+// CommitTxRoot commits the Merkle root of the TXs in their current order in the header, the order
+// the State applies them since TIP8 fork.
+func (b *Block) CommitTxRoot() error {
+	root, err := TxsMerkleRoot(b.Txs)
+	if err != nil {
+		return err
+	}
+	b.Header.TxRoot = &root
+
+	return nil
+}
+
+// TipReward returns the tips of the block TXs paid to the miner since TIP11 fork, their fees without the burned base fee.
+func (b Block) TipReward(baseFee uint) uint {
 	reward := uint(0)
 
 	for _, tx := range b.Txs {
-		reward += tx.GasCost()
+		reward += tx.TipAt(baseFee)
 	}
 
 	return reward
 }
 
-func IsBlockHashValid(h Hash, miningDifficulty uint) bool {
-	zeroesCount := uint(0)
+func (b Block) GasReward() uint {
+	reward := uint(0)
 
-	for i := uint(0); i < miningDifficulty; i++ {
-		if fmt.Sprintf("%x", h[i]) == "0" {
-			zeroesCount++
-		}
+	for _, tx := range b.Txs {
+		reward += tx.GasCost()
 	}
 
-	if fmt.Sprintf("%x", h[miningDifficulty]) == "0" {
-		return false
-	}
+	return reward
+}
+
+// IsBlockHashValid reports whether the hash starts with exactly miningDifficulty zero bytes, the PoW before TIP6 fork.
+func IsBlockHashValid(h Hash, miningDifficulty uint) bool {
+	target := DifficultyTarget(miningDifficulty)
 
-	return zeroesCount == miningDifficulty
+	return h.MeetsPoW(&target, false)
 }
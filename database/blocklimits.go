@@ -0,0 +1,93 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DefaultBlockGasLimit is the gas all the TXs of a block can use since TIP10 fork, unless the genesis sets it.
+const DefaultBlockGasLimit = 1000 * TxGas
+
+// DefaultMaxBlockSize is the JSON encoded size of a block in bytes since TIP10 fork, unless the genesis sets it.
+const DefaultMaxBlockSize = 1024 * 1024
+
+// minMaxBlockSize leaves room for a block header with its reward TXs and a few transfers.
+const minMaxBlockSize = 1024
+
+// Size returns the length of the JSON encoded block, the way it's stored and sent to peers.
+func (b Block) Size() (uint, error) {
+	blockJson, err := json.Marshal(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint(len(blockJson)), nil
+}
+
+// GasUsed returns the gas of all the block TXs.
+func (b Block) GasUsed() uint {
+	gas := uint(0)
+
+	for _, tx := range b.Txs {
+		gas += tx.Gas
+	}
+
+	return gas
+}
+
+// FitBlockLimits returns the TXs, in order, which can be added to the block within the block gas limit
+// and maximum block size. A TX which doesn't fit is left out together with the later TXs of its sender,
+// their nonces can't be applied without it.
+func (c ChainConfig) FitBlockLimits(b Block, txs []SignedTx) ([]SignedTx, error) {
+	// An empty payload is encoded as "[]", every TX adds its JSON and a separating comma at most
+	b.Txs = append(make([]SignedTx, 0, len(b.Txs)), b.Txs...)
+
+	size, err := b.Size()
+	if err != nil {
+		return nil, err
+	}
+	gas := b.GasUsed()
+
+	fitting := make([]SignedTx, 0, len(txs))
+	skipped := make(map[string]struct{})
+
+	for _, tx := range txs {
+		if _, ok := skipped[tx.From.Hex()]; ok {
+			continue
+		}
+
+		txJson, err := json.Marshal(tx)
+		if err != nil {
+			return nil, err
+		}
+
+		if gas+tx.Gas > c.BlockGasLimit || size+uint(len(txJson))+1 > c.MaxBlockSize {
+			skipped[tx.From.Hex()] = struct{}{}
+			continue
+		}
+
+		gas += tx.Gas
+		size += uint(len(txJson)) + 1
+		fitting = append(fitting, tx)
+	}
+
+	return fitting, nil
+}
+
+// verifyBlockLimits checks the block is within the block gas limit and maximum block size, required since TIP10 fork.
+func verifyBlockLimits(b Block, config ChainConfig) error {
+	if gas := b.GasUsed(); gas > config.BlockGasLimit {
+		return fmt.Errorf("invalid block. TXs use %d gas, more than the block gas limit %d", gas, config.BlockGasLimit)
+	}
+
+	size, err := b.Size()
+	if err != nil {
+		return err
+	}
+
+	if size > config.MaxBlockSize {
+		return fmt.Errorf("invalid block. Block is %d bytes, more than the maximum block size %d", size, config.MaxBlockSize)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestChainConfig_FitBlockLimits(t *testing.T) {
+	keyA, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyB, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	senderA := crypto.PubkeyToAddress(keyA.PublicKey)
+	senderB := crypto.PubkeyToAddress(keyB.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+
+	a1 := signTestTx(t, NewBaseTx(senderA, receiver, 1, 1, ""), keyA)
+	a2 := signTestTx(t, NewBaseTx(senderA, receiver, 1, 2, ""), keyA)
+	a3 := signTestTx(t, NewBaseTx(senderA, receiver, 1, 3, ""), keyA)
+	b1 := signTestTx(t, NewBaseTx(senderB, receiver, 1, 1, ""), keyB)
+
+	template := NewBlock(Hash{}, 0, 0, 1650000000, receiver, nil)
+
+	config := ChainConfig{BlockGasLimit: 3 * TxGas, MaxBlockSize: DefaultMaxBlockSize}
+	txs, err := config.FitBlockLimits(template, []SignedTx{a1, b1, a2, a3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(txs) != 3 || txs[2].Nonce != 2 {
+		t.Fatalf("the TXs must fit 3 TXs worth of gas, got %+v", txs)
+	}
+
+	// A TX too large for the block holds back the later TXs of its sender only
+	large := signTestTx(t, NewBaseTx(senderA, receiver, 1, 1, strings.Repeat("x", minMaxBlockSize)), keyA)
+
+	config = ChainConfig{BlockGasLimit: DefaultBlockGasLimit, MaxBlockSize: minMaxBlockSize}
+	txs, err = config.FitBlockLimits(template, []SignedTx{large, b1, a2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(txs) != 1 || txs[0].From != senderB {
+		t.Fatalf("only the TX of sender B must fit, got %+v", txs)
+	}
+
+	b := template
+	b.Txs = txs
+	if err := verifyBlockLimits(b, config); err != nil {
+		t.Fatalf("block of the fitting TXs must be within the limits, got: %s", err)
+	}
+}
+
+func TestState_BlockLimitsFork(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+
+	dataDir := setupTestDataDirWithGenesis(t, Genesis{
+		Balances:      map[common.Address]uint{sender: 1000},
+		BlockGasLimit: 2 * TxGas,
+		MaxBlockSize:  minMaxBlockSize,
+		Forks:         map[string]uint64{ForkTIP10: 0},
+	})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	tx1 := signTestTx(t, NewBaseTx(sender, receiver, 10, 1, ""), key)
+	tx2 := signTestTx(t, NewBaseTx(sender, receiver, 10, 2, ""), key)
+	tx3 := signTestTx(t, NewBaseTx(sender, receiver, 10, 3, ""), key)
+	large := signTestTx(t, NewBaseTx(sender, receiver, 10, 1, strings.Repeat("x", minMaxBlockSize)), key)
+
+	if _, err := state.AddBlock(mineTestBlock(t, Hash{}, 0, miner, []SignedTx{tx1, tx2, tx3})); err == nil {
+		t.Fatal("block over the block gas limit must be rejected")
+	}
+
+	if _, err := state.AddBlock(mineTestBlock(t, Hash{}, 0, miner, []SignedTx{large})); err == nil {
+		t.Fatal("block over the maximum block size must be rejected")
+	}
+
+	addTestBlock(t, state, mineTestBlock(t, Hash{}, 0, miner, []SignedTx{tx1, tx2}))
+}
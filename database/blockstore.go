@@ -0,0 +1,72 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+const FileDBEngine = "file"
+const LevelDBEngine = "leveldb"
+
+var ErrBlockNotFound = errors.New("block not found")
+
+// BlockStore persists the blocks of the main chain.
+type BlockStore interface {
+	// Append stores the block as the new tip of the main chain.
+	Append(hash Hash, b Block) error
+
+	// BlockByHash returns a main chain block or ErrBlockNotFound.
+	BlockByHash(hash Hash) (BlockFS, error)
+
+	// BlockByHeight returns a main chain block or ErrBlockNotFound.
+	BlockByHeight(height uint64) (BlockFS, error)
+
+	// Iterate calls fn for every block starting at the given height, in the chain order.
+	Iterate(fromHeight uint64, fn func(BlockFS) error) error
+
+	// Truncate removes all the blocks starting at the given height, e.g. when they get detached by a reorg.
+	Truncate(fromHeight uint64) error
+
+	Close() error
+}
+
+// OpenBlockStore opens the block store of the data dir using the given engine.
+//
+// An empty engine picks the one the data dir was created with, defaulting to the FileDBEngine.
+// The data dir must be initialized, see InitDataDir.
+func OpenBlockStore(dataDir, engine string) (BlockStore, error) {
+	if err := checkDataDirInitialized(dataDir); err != nil {
+		return nil, err
+	}
+
+	if engine == "" {
+		engine = dataDirDBEngine(dataDir)
+	}
+
+	switch engine {
+	case FileDBEngine:
+		store, err := NewFileBlockStore(dataDir)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+
+	case LevelDBEngine:
+		store, err := NewLevelDBBlockStore(dataDir)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+
+	return nil, fmt.Errorf("unknown db engine '%s', must be one of: %s, %s", engine, FileDBEngine, LevelDBEngine)
+}
+
+// dataDirDBEngine returns the engine the data dir was created with.
+func dataDirDBEngine(dataDir string) string {
+	if fileExists(getBlocksLevelDBDirPath(dataDir)) {
+		return LevelDBEngine
+	}
+
+	return FileDBEngine
+}
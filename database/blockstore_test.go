@@ -0,0 +1,439 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestBlockStore(t *testing.T) {
+	for _, engine := range []string{FileDBEngine, LevelDBEngine} {
+		t.Run(engine, func(t *testing.T) {
+			dataDir := setupTestDataDir(t, map[common.Address]uint{})
+			defer os.RemoveAll(dataDir)
+
+			store, err := OpenBlockStore(dataDir, engine)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			miner := NewAccount("0x00000000000000000000000000000000000000aa")
+			hashes := make([]Hash, 0)
+
+			parent := Hash{}
+			for i := uint64(0); i < 5; i++ {
+				b := NewBlock(parent, i, 0, 1650000000+i, miner, nil)
+				parent, err = b.Hash()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := store.Append(parent, b); err != nil {
+					t.Fatal(err)
+				}
+				hashes = append(hashes, parent)
+			}
+
+			blockFs, err := store.BlockByHash(hashes[3])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if blockFs.Value.Header.Number != 3 {
+				t.Fatalf("block by hash must be number 3, got %d", blockFs.Value.Header.Number)
+			}
+
+			blockFs, err = store.BlockByHeight(2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if blockFs.Key != hashes[2] {
+				t.Fatalf("block by height 2 must be '%x', got '%x'", hashes[2], blockFs.Key)
+			}
+
+			if err := store.Truncate(3); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := store.BlockByHash(hashes[4]); !errors.Is(err, ErrBlockNotFound) {
+				t.Fatalf("truncated block must not be found, got %v", err)
+			}
+
+			// The store must be consistent after reopening
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			store, err = OpenBlockStore(dataDir, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+
+			iterated := make([]Hash, 0)
+			err = store.Iterate(1, func(blockFs BlockFS) error {
+				iterated = append(iterated, blockFs.Key)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(iterated) != 2 || iterated[0] != hashes[1] || iterated[1] != hashes[2] {
+				t.Fatalf("iterating from height 1 must return blocks 1 and 2, got %d blocks", len(iterated))
+			}
+		})
+	}
+}
+
+func TestFileBlockStore_ChainFromHeightOne(t *testing.T) {
+	senderKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(senderKey.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+
+	dataDir := setupTestDataDir(t, map[common.Address]uint{sender: 1000})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The node numbers its first mined block 1
+	tx := signTestTx(t, NewBaseTx(sender, receiver, 10, 1, ""), senderKey)
+	b1Hash := addTestBlock(t, state, mineTestBlock(t, Hash{}, 1, miner, []SignedTx{tx}))
+	b2Hash := addTestBlock(t, state, mineTestBlock(t, b1Hash, 2, miner, nil))
+
+	if err := state.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewFileBlockStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iterated := make([]Hash, 0)
+	err = store.Iterate(0, func(blockFs BlockFS) error {
+		iterated = append(iterated, blockFs.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(iterated) != 2 || iterated[0] != b1Hash || iterated[1] != b2Hash {
+		t.Fatalf("iterating from height 0 must return blocks 1 and 2, got %d blocks", len(iterated))
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	if reloaded.LatestBlockHash() != b2Hash || reloaded.LatestBlock().Header.Number != 2 {
+		t.Fatalf("reopened State must be at block 2 '%x', got %d '%x'", b2Hash, reloaded.LatestBlock().Header.Number, reloaded.LatestBlockHash())
+	}
+
+	if reloaded.Balances[receiver] != 10 {
+		t.Fatalf("reopened State must replay the transfer, receiver balance is %d", reloaded.Balances[receiver])
+	}
+}
+
+func TestFileBlockStore_Index(t *testing.T) {
+	dataDir := setupTestDataDir(t, map[common.Address]uint{})
+	defer os.RemoveAll(dataDir)
+
+	store, err := NewFileBlockStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+	blocks := make([]BlockFS, 0)
+
+	parent := Hash{}
+	for i := uint64(0); i < 4; i++ {
+		b := NewBlock(parent, i, 0, 1650000000+i, miner, nil)
+		parent, err = b.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, BlockFS{Key: parent, Value: b})
+	}
+
+	for _, blockFs := range blocks[:3] {
+		if err := store.Append(blockFs.Key, blockFs.Value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	offset, _, err := store.heightEntry(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash after the block was written but before it was indexed
+	blockFsJson, err := json.Marshal(blocks[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(append(blockFsJson, '\n')); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	store, err = NewFileBlockStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.BlockByHash(blocks[3].Key); err != nil {
+		t.Fatalf("block appended after the last indexed one must be indexed on open: %s", err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cut the block.db in the middle of an indexed record
+	if err := os.Truncate(getBlocksDbFilePath(dataDir), offset+5); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileBlockStore(dataDir); !errors.Is(err, ErrCorruptBlockIndex) {
+		t.Fatalf("an index of a cut record must be reported as corrupt, got %v", err)
+	}
+
+	// Cut the block.db behind the index, like a crash before the index write of a Truncate was durable
+	if err := os.Truncate(getBlocksDbFilePath(dataDir), offset); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = NewFileBlockStore(dataDir)
+	if err != nil {
+		t.Fatalf("an index ahead of the block.db must drop the missing blocks: %s", err)
+	}
+
+	if _, err := store.BlockByHeight(1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, blockFs := range blocks[2:] {
+		if _, err := store.BlockByHash(blockFs.Key); !errors.Is(err, ErrBlockNotFound) {
+			t.Fatalf("block cut from the block.db must not be indexed, got %v", err)
+		}
+	}
+
+	if err := store.Append(blocks[2].Key, blocks[2].Value); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RebuildBlockIndex(dataDir); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = NewFileBlockStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if _, err := store.BlockByHeight(2); err != nil {
+		t.Fatalf("block appended after the recovery must be indexed: %s", err)
+	}
+
+	if _, err := store.BlockByHeight(3); !errors.Is(err, ErrBlockNotFound) {
+		t.Fatalf("block cut from the block.db must not be indexed, got %v", err)
+	}
+}
+
+func TestFileBlockStore_TruncateFromHeightBelowChain(t *testing.T) {
+	dataDir := setupTestDataDir(t, map[common.Address]uint{})
+	defer os.RemoveAll(dataDir)
+
+	store, err := NewFileBlockStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+	blocks := make([]BlockFS, 0)
+
+	// The chain starts at height 1, there is no block 0 to truncate from
+	parent := Hash{}
+	for i := uint64(1); i <= 3; i++ {
+		b := NewBlock(parent, i, 0, 1650000000+i, miner, nil)
+		parent, err = b.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, BlockFS{Key: parent, Value: b})
+	}
+
+	for _, blockFs := range blocks {
+		if err := store.Append(blockFs.Key, blockFs.Value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.Truncate(0); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, blockFs := range blocks {
+		if _, err := store.BlockByHash(blockFs.Key); !errors.Is(err, ErrBlockNotFound) {
+			t.Fatalf("truncating from below the chain must drop block %d, got %v", blockFs.Value.Header.Number, err)
+		}
+	}
+
+	if store.size != 0 || store.meta != (fileIndexMeta{}) {
+		t.Fatalf("truncating from below the chain must empty the block.db and its index, got %d bytes and %+v", store.size, store.meta)
+	}
+
+	for _, blockFs := range blocks[:2] {
+		if err := store.Append(blockFs.Key, blockFs.Value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cut the whole block.db behind the index, every indexed block must be dropped on open
+	if err := os.Truncate(getBlocksDbFilePath(dataDir), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = NewFileBlockStore(dataDir)
+	if err != nil {
+		t.Fatalf("an index ahead of an empty block.db must drop all its blocks: %s", err)
+	}
+	defer store.Close()
+
+	if _, err := store.BlockByHeight(1); !errors.Is(err, ErrBlockNotFound) {
+		t.Fatalf("block cut from the block.db must not be indexed, got %v", err)
+	}
+
+	if err := store.Append(blocks[0].Key, blocks[0].Value); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.BlockByHeight(1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileBlockStore_TornTail(t *testing.T) {
+	dataDir := setupTestDataDir(t, map[common.Address]uint{})
+	defer os.RemoveAll(dataDir)
+
+	store, err := NewFileBlockStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+	blocks := make([]BlockFS, 0)
+
+	parent := Hash{}
+	for i := uint64(0); i < 3; i++ {
+		b := NewBlock(parent, i, 0, 1650000000+i, miner, nil)
+		parent, err = b.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, BlockFS{Key: parent, Value: b})
+	}
+
+	for _, blockFs := range blocks[:2] {
+		if err := store.Append(blockFs.Key, blockFs.Value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	size := store.size
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := encodeBlockRecord(blocks[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A record cut in half and a complete record with a flipped byte must both be dropped
+	damaged := append([]byte{}, record...)
+	damaged[len(damaged)-10] ^= 0x01
+
+	for _, tail := range [][]byte{record[:len(record)/2], damaged} {
+		f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(tail); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+
+		store, err = NewFileBlockStore(dataDir)
+		if err != nil {
+			t.Fatalf("store with a torn tail record must open: %s", err)
+		}
+
+		if store.size != size {
+			t.Fatalf("torn record must be truncated to %d bytes, block.db has %d", size, store.size)
+		}
+
+		if _, err := store.BlockByHeight(2); !errors.Is(err, ErrBlockNotFound) {
+			t.Fatalf("torn block must not be indexed, got %v", err)
+		}
+
+		if err := store.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A damaged record followed by valid ones is not a torn write
+	content, err := ioutil.ReadFile(getBlocksDbFilePath(dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content[blockRecordHeaderLen+5] ^= 0x01
+
+	if err := ioutil.WriteFile(getBlocksDbFilePath(dataDir), content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RebuildBlockIndex(dataDir); err == nil {
+		t.Fatal("damaged record in the middle of the block.db must fail the reindex")
+	}
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// MedianTimeSpan is the number of previous blocks whose median time a block must be after since TIP9 fork,
+// the block times kept for the difficulty retargeting.
+const MedianTimeSpan = DifficultyRetargetInterval + 1
+
+// ErrFutureBlock is returned for blocks too far ahead of the node time. They aren't invalid, just early.
+var ErrFutureBlock = errors.New("block is too far in the future")
+
+// MedianTimePast returns the median time of the latest MedianTimeSpan main chain blocks, 0 before the first block.
+func (s *State) MedianTimePast() uint64 {
+	return medianTime(s.blockTimes)
+}
+
+// NextBlockTime returns the earliest time the next block can have since TIP9 fork, or the given time if later.
+func (s *State) NextBlockTime(now uint64) uint64 {
+	if !s.Rules().IsTIP9 || len(s.blockTimes) == 0 {
+		return now
+	}
+
+	if mtp := s.MedianTimePast(); now <= mtp {
+		return mtp + 1
+	}
+
+	return now
+}
+
+// VerifyBlockTimeDrift checks the block time is at most maxDrift seconds ahead of now, the node time.
+func VerifyBlockTimeDrift(b Block, now uint64, maxDrift uint64) error {
+	if b.Header.Time > now+maxDrift {
+		return fmt.Errorf("%w. Block %d time %d is %d seconds ahead of the node time, more than the allowed %d", ErrFutureBlock, b.Header.Number, b.Header.Time, b.Header.Time-now, maxDrift)
+	}
+
+	return nil
+}
+
+// verifyMedianTimePast checks the block time is after the median time of the previous blocks, required since TIP9 fork.
+func verifyMedianTimePast(b Block, s *State) error {
+	if len(s.blockTimes) == 0 {
+		return nil
+	}
+
+	if mtp := s.MedianTimePast(); b.Header.Time <= mtp {
+		return fmt.Errorf("invalid block. Time %d must be after %d, the median time of the previous %d blocks", b.Header.Time, mtp, len(s.blockTimes))
+	}
+
+	return nil
+}
+
+// medianTime returns the median of the latest MedianTimeSpan times, 0 if there are none.
+func medianTime(times []uint64) uint64 {
+	if len(times) > MedianTimeSpan {
+		times = times[len(times)-MedianTimeSpan:]
+	}
+
+	if len(times) == 0 {
+		return 0
+	}
+
+	sorted := make([]uint64, len(times))
+	copy(sorted, times)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	return sorted[len(sorted)/2]
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestMedianTime(t *testing.T) {
+	tests := []struct {
+		times  []uint64
+		median uint64
+	}{
+		{nil, 0},
+		{[]uint64{5}, 5},
+		{[]uint64{9, 1, 5}, 5},
+		{[]uint64{1, 2, 3, 4}, 3},
+		// Only the latest MedianTimeSpan times count
+		{[]uint64{100, 100, 100, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, 6},
+	}
+
+	for _, tc := range tests {
+		if median := medianTime(tc.times); median != tc.median {
+			t.Errorf("median of %v must be %d, got %d", tc.times, tc.median, median)
+		}
+	}
+}
+
+func TestState_MedianTimePast(t *testing.T) {
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+
+	dataDir := setupTestDataDirWithGenesis(t, Genesis{
+		Balances: map[common.Address]uint{miner: 1000},
+		Forks:    map[string]uint64{ForkTIP9: 0},
+	})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	mineBlock := func(parent Hash, number uint64, time uint64) Block {
+		return mineTestPreparedBlock(t, NewBlock(parent, number, 0, time, miner, nil))
+	}
+
+	if time := state.NextBlockTime(100); time != 100 {
+		t.Fatalf("first block time can't be constrained, got %d", time)
+	}
+
+	// A block time can go back a little, as long as it's after the median
+	parent := Hash{}
+	for number, time := range []uint64{1000, 1010, 1020, 1015} {
+		parent = addTestBlock(t, state, mineBlock(parent, uint64(number), time))
+	}
+
+	if mtp := state.MedianTimePast(); mtp != 1015 {
+		t.Fatalf("median time past must be 1015, got %d", mtp)
+	}
+
+	for _, time := range []uint64{900, 1015} {
+		if _, err := state.AddBlock(mineBlock(parent, 4, time)); err == nil {
+			t.Errorf("block time %d not after the median time must be rejected", time)
+		}
+	}
+
+	if time := state.NextBlockTime(1000); time != 1016 {
+		t.Fatalf("next block time must be moved after the median time, got %d", time)
+	}
+
+	addTestBlock(t, state, mineBlock(parent, 4, state.NextBlockTime(1000)))
+}
+
+func TestVerifyBlockTimeDrift(t *testing.T) {
+	b := NewBlock(Hash{}, 0, 0, 1000, common.Address{}, nil)
+
+	if err := VerifyBlockTimeDrift(b, 900, 100); err != nil {
+		t.Fatalf("block within the drift must be accepted, got: %s", err)
+	}
+
+	if err := VerifyBlockTimeDrift(b, 899, 100); !errors.Is(err, ErrFutureBlock) {
+		t.Fatalf("block beyond the drift must be a future block, got: %v", err)
+	}
+}
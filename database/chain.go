@@ -0,0 +1,610 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// MaxReorgDepth is the number of most recent main chain blocks the State keeps enough
+// information about to roll them back when a heavier side branch shows up.
+const MaxReorgDepth = 100
+
+// Reorg describes a switch of the main chain onto a heavier side branch.
+type Reorg struct {
+	CommonAncestor Hash
+
+	// Detached are the blocks removed from the main chain, oldest first.
+	Detached []Block
+
+	// Attached are the blocks of the new main chain after the CommonAncestor, oldest first.
+	Attached []Block
+}
+
+// OrphanedTXs returns the TXs of the detached blocks that are not part of the new main chain.
+// Reward TXs are left out, they are valid only in the block they were minted in.
+func (r *Reorg) OrphanedTXs() []SignedTx {
+	attached := make(map[Hash]struct{})
+
+	for _, b := range r.Attached {
+		for _, tx := range b.Txs {
+			txHash, err := tx.Hash()
+			if err != nil {
+				continue
+			}
+			attached[txHash] = struct{}{}
+		}
+	}
+
+	orphaned := make([]SignedTx, 0)
+
+	for _, b := range r.Detached {
+		for _, tx := range b.Txs {
+			if tx.IsReward() {
+				continue
+			}
+
+			txHash, err := tx.Hash()
+			if err != nil {
+				continue
+			}
+
+			if _, ok := attached[txHash]; !ok {
+				orphaned = append(orphaned, tx)
+			}
+		}
+	}
+
+	return orphaned
+}
+
+// chainBlock is a block known to the State together with the cumulative work of the chain ending with it.
+//
+// Main chain blocks also remember the account values they replaced, so they can be rolled back during a reorg,
+// and the difficulty, block times and immature rewards after them, restored when a reorg forks off them.
+type chainBlock struct {
+	hash  Hash
+	block Block
+	work  *big.Int
+	undo  accountsUndo
+
+	difficulty uint
+	blockTimes []uint64
+	immature   []ImmatureReward
+}
+
+// accountsUndo holds the Balances and Account2Nonce values overwritten by a block.
+type accountsUndo struct {
+	balances    map[common.Address]uint
+	nonces      map[common.Address]uint
+	newBalances []common.Address
+	newNonces   []common.Address
+}
+
+func newAccountsUndo(before, after *State) accountsUndo {
+	undo := accountsUndo{
+		balances: make(map[common.Address]uint),
+		nonces:   make(map[common.Address]uint),
+	}
+
+	for acc, balance := range after.Balances {
+		prev, ok := before.Balances[acc]
+		if !ok {
+			undo.newBalances = append(undo.newBalances, acc)
+			continue
+		}
+
+		if prev != balance {
+			undo.balances[acc] = prev
+		}
+	}
+
+	for acc, nonce := range after.Account2Nonce {
+		prev, ok := before.Account2Nonce[acc]
+		if !ok {
+			undo.newNonces = append(undo.newNonces, acc)
+			continue
+		}
+
+		if prev != nonce {
+			undo.nonces[acc] = prev
+		}
+	}
+
+	return undo
+}
+
+func (u accountsUndo) revert(s *State) {
+	for acc, balance := range u.balances {
+		s.Balances[acc] = balance
+		s.accountChanged(acc)
+	}
+
+	for acc, nonce := range u.nonces {
+		s.Account2Nonce[acc] = nonce
+		s.accountChanged(acc)
+	}
+
+	for _, acc := range u.newBalances {
+		delete(s.Balances, acc)
+		s.accountChanged(acc)
+	}
+
+	for _, acc := range u.newNonces {
+		delete(s.Account2Nonce, acc)
+		s.accountChanged(acc)
+	}
+}
+
+// BlockWork returns the expected number of hashes required to mine a block with the given difficulty,
+// the Work of its DifficultyTarget.
+func BlockWork(miningDifficulty uint) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), 8*miningDifficulty)
+}
+
+// ChainWork returns the cumulative work of the main chain.
+func (s *State) ChainWork() *big.Int {
+	return new(big.Int).Set(s.chainWork)
+}
+
+// IsKnownBlock reports whether the block is part of the main chain or of a tracked side branch.
+func (s *State) IsKnownBlock(hash Hash) bool {
+	if _, ok := s.sideBlocks[hash]; ok {
+		return true
+	}
+
+	return s.IsMainChainBlock(hash)
+}
+
+// IsMainChainBlock reports whether the block is part of the main chain.
+func (s *State) IsMainChainBlock(hash Hash) bool {
+	if _, ok := s.mainChainIndex(hash); ok {
+		return true
+	}
+
+	_, err := s.store.BlockByHash(hash)
+
+	return err == nil
+}
+
+// BlockLocator returns hashes of the recent main chain blocks, from the tip backwards, with an exponentially
+// growing step. A peer uses the first hash it knows as the fork point to send blocks from.
+//
+// The empty hash (meaning "from the very beginning") is included only if a reorg from the first block is possible.
+func (s *State) BlockLocator() []Hash {
+	locator := make([]Hash, 0)
+
+	step := 1
+	for i := len(s.mainChain) - 1; i >= 0; i -= step {
+		locator = append(locator, s.mainChain[i].hash)
+
+		if len(locator) > 10 {
+			step *= 2
+		}
+	}
+
+	if len(s.mainChain) == 0 || s.isFirstBlock(s.mainChain[0].block) {
+		locator = append(locator, Hash{})
+	}
+
+	return locator
+}
+
+// rollback returns a copy of the State rolled back to after the recent main chain block at the index,
+// or before the first one for -1, with the difficulty, block times and immature rewards after it.
+func (s *State) rollback(idx int) State {
+	past := s.Copy()
+
+	for i := len(s.mainChain) - 1; i > idx; i-- {
+		s.mainChain[i].undo.revert(&past)
+	}
+
+	if idx >= 0 {
+		cb := s.mainChain[idx]
+
+		past.latestBlock = cb.block
+		past.latestBlockHash = cb.hash
+		past.miningDifficulty = cb.difficulty
+		past.blockTimes = cb.blockTimes
+		past.immature = cb.immature
+	} else if len(s.mainChain) > 0 {
+		past.latestBlock = Block{}
+		past.latestBlockHash = Hash{}
+		past.hasGenesisBlock = false
+
+		// The difficulty after the first block is the initial one it was mined with
+		past.miningDifficulty = s.mainChain[0].difficulty
+		past.blockTimes = nil
+		past.immature = nil
+	}
+	past.baseFee = past.NextBaseFee()
+
+	return past
+}
+
+// isFirstBlock reports whether the block is the first one of its chain, whatever its number.
+func (s *State) isFirstBlock(b Block) bool {
+	return b.Header.Parent == s.firstBlockParent()
+}
+
+// mainChainIndex returns the position of the block within the recent main chain blocks.
+func (s *State) mainChainIndex(hash Hash) (int, bool) {
+	for i := len(s.mainChain) - 1; i >= 0; i-- {
+		if s.mainChain[i].hash == hash {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// connectBlock records an already applied block as the new tip of the main chain.
+func (s *State) connectBlock(cb *chainBlock) {
+	s.mainChain = append(s.mainChain, cb)
+	if len(s.mainChain) > MaxReorgDepth {
+		s.mainChain = s.mainChain[len(s.mainChain)-MaxReorgDepth:]
+	}
+
+	s.latestBlock = cb.block
+	s.latestBlockHash = cb.hash
+	s.hasGenesisBlock = true
+	s.chainWork = cb.work
+	s.blockTimes = cb.blockTimes
+	s.immature = cb.immature
+	s.baseFee = s.NextBaseFee()
+
+	s.pruneSideBlocks()
+}
+
+// pruneSideBlocks forgets side branches that forked off too deep to ever cause a reorg.
+func (s *State) pruneSideBlocks() {
+	if len(s.mainChain) == 0 {
+		return
+	}
+
+	oldest := s.mainChain[0].block.Header.Number
+	for hash, cb := range s.sideBlocks {
+		if cb.block.Header.Number <= oldest {
+			delete(s.sideBlocks, hash)
+		}
+	}
+}
+
+// evictSideBranch forgets the side block and all side blocks built on top of it.
+func (s *State) evictSideBranch(hash Hash) {
+	evicted := map[Hash]struct{}{hash: {}}
+	delete(s.sideBlocks, hash)
+
+	for found := true; found; {
+		found = false
+
+		for h, cb := range s.sideBlocks {
+			if _, ok := evicted[cb.block.Header.Parent]; ok {
+				evicted[h] = struct{}{}
+				delete(s.sideBlocks, h)
+				found = true
+			}
+		}
+	}
+}
+
+// addSideBlock stores a block that doesn't extend the current tip and reorganises the main chain
+// onto its branch if the branch has more cumulative work.
+func (s *State) addSideBlock(b Block, hash Hash) (*Reorg, error) {
+	var parentWork *big.Int
+	var parentNumber int64
+
+	if idx, ok := s.mainChainIndex(b.Header.Parent); ok {
+		parentWork = s.mainChain[idx].work
+		parentNumber = int64(s.mainChain[idx].block.Header.Number)
+	} else if parent, ok := s.sideBlocks[b.Header.Parent]; ok {
+		parentWork = parent.work
+		parentNumber = int64(parent.block.Header.Number)
+	} else if b.Header.Parent == s.firstBlockParent() {
+		parentWork = big.NewInt(0)
+		parentNumber = -1
+	} else {
+		return nil, fmt.Errorf("block '%x' has unknown parent '%x' or forks off deeper than %d blocks", hash, b.Header.Parent, MaxReorgDepth)
+	}
+
+	// Like applyBlock, the number of the first block isn't checked, the node numbers it 1
+	if parentNumber >= 0 && int64(b.Header.Number) != parentNumber+1 {
+		return nil, fmt.Errorf("next expected block must '%d' not '%d'", parentNumber+1, b.Header.Number)
+	}
+
+	// The committed target is verified once the branch is applied, the PoW is checked upfront
+	target, err := blockTarget(b, s.miningDifficulty)
+	if err != nil {
+		return nil, err
+	}
+
+	// The same rules applyBlock uses, those of the NextBlockNumber after the parent, 0 for the first block
+	rules := s.config.Rules(uint64(parentNumber + 1))
+	if !hash.MeetsPoW(&target, rules.IsTIP6) {
+		return nil, fmt.Errorf("invalid block hash %x", hash)
+	}
+
+	// The hash covers only the header once it commits the TXs, forged TXs must not be stored under it
+	if b.Header.TxRoot != nil {
+		if err := verifyTxRoot(b, rules); err != nil {
+			return nil, err
+		}
+	}
+
+	s.sideBlocks[hash] = &chainBlock{
+		hash:  hash,
+		block: b,
+		work:  new(big.Int).Add(parentWork, target.Work()),
+	}
+
+	if s.sideBlocks[hash].work.Cmp(s.chainWork) <= 0 {
+		fmt.Printf("Stored side branch Block '%x' at height %d\n", hash, b.Header.Number)
+		return nil, nil
+	}
+
+	return s.reorganize(hash)
+}
+
+// reorganize rolls the main chain back to the common ancestor with the side branch ending with tip,
+// and applies the branch on top of it. The State is left untouched if any branch block is invalid.
+//
+// The whole branch is validated before the BlockStore is rewritten. An interrupted rewrite is completed
+// from its reorgJournal, right away with the State reloaded from the store, or the next time the data dir is opened.
+func (s *State) reorganize(tip Hash) (*Reorg, error) {
+	branch := make([]*chainBlock, 0)
+	forkIdx := -1
+
+	for cur := s.sideBlocks[tip]; ; {
+		branch = append([]*chainBlock{cur}, branch...)
+		parent := cur.block.Header.Parent
+
+		if idx, ok := s.mainChainIndex(parent); ok {
+			forkIdx = idx
+			break
+		}
+
+		next, ok := s.sideBlocks[parent]
+		if !ok {
+			if parent != s.firstBlockParent() || (len(s.mainChain) > 0 && !s.isFirstBlock(s.mainChain[0].block)) {
+				return nil, fmt.Errorf("side branch of block '%x' forks off deeper than %d blocks", tip, MaxReorgDepth)
+			}
+			break
+		}
+		cur = next
+	}
+
+	detached := s.mainChain[forkIdx+1:]
+
+	fmt.Printf("\nReorganizing: replacing %d main chain blocks with %d blocks of a heavier branch\n", len(detached), len(branch))
+
+	pending := s.rollback(forkIdx)
+	diffs := make([]accountsDiff, 0, len(branch))
+
+	for _, cb := range branch {
+		next := pending.Copy()
+
+		if err := applyBlock(cb.block, &next); err != nil {
+			s.evictSideBranch(cb.hash)
+
+			return nil, fmt.Errorf("side branch block '%x' is invalid: %w", cb.hash, err)
+		}
+
+		cb.undo = newAccountsUndo(&pending, &next)
+		diffs = append(diffs, newAccountsDiff(cb.hash, cb.undo, &next))
+		cb.difficulty = next.miningDifficulty
+		cb.blockTimes = next.blockTimes
+		cb.immature = next.immature
+
+		next.latestBlock = cb.block
+		next.latestBlockHash = cb.hash
+		next.hasGenesisBlock = true
+		next.baseFee = next.NextBaseFee()
+		pending = next
+	}
+
+	reorg := &Reorg{CommonAncestor: s.firstBlockParent()}
+	if forkIdx >= 0 {
+		reorg.CommonAncestor = s.mainChain[forkIdx].hash
+	}
+
+	for _, cb := range detached {
+		reorg.Detached = append(reorg.Detached, cb.block)
+	}
+
+	for _, cb := range branch {
+		reorg.Attached = append(reorg.Attached, cb.block)
+	}
+
+	// The whole branch is valid, rewrite the stored main chain from the fork point
+	journal, err := newReorgJournal(reorg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeReorgJournal(s.dataDir, journal); err != nil {
+		return nil, err
+	}
+
+	if err := s.rewriteMainChain(journal, reorg.Detached, diffs); err != nil {
+		// The store is partly rewritten, the State is rebuilt from it once the rewrite completes
+		if reloadErr := s.reload(); reloadErr != nil {
+			return nil, fmt.Errorf("reorg onto block '%x' is interrupted: %w. It's completed the next time the data dir is opened, reloading the State failed: %s", tip, err, reloadErr)
+		}
+
+		fmt.Printf("Reorg onto block '%x' completed after an error: %s\n", tip, err.Error())
+
+		return reorg, nil
+	}
+
+	// Move the detached blocks into side branches
+	for _, cb := range detached {
+		s.sideBlocks[cb.hash] = &chainBlock{hash: cb.hash, block: cb.block, work: cb.work}
+	}
+
+	s.mainChain = s.mainChain[:forkIdx+1]
+	if forkIdx < 0 {
+		s.hasGenesisBlock = false
+	}
+
+	s.Balances = pending.Balances
+	s.Account2Nonce = pending.Account2Nonce
+	s.accounts = pending.accounts
+	s.miningDifficulty = pending.miningDifficulty
+
+	for _, cb := range branch {
+		delete(s.sideBlocks, cb.hash)
+		s.connectBlock(cb)
+	}
+
+	s.snapshotIfDue()
+
+	return reorg, nil
+}
+
+// reorgJournal is the main chain rewrite of a reorg, persisted before the BlockStore is modified
+// so a rewrite interrupted by a crash or an I/O error is completed the next time the data dir is opened.
+type reorgJournal struct {
+	FromHeight uint64    `json:"from_height"`
+	Blocks     []BlockFS `json:"blocks"`
+}
+
+func newReorgJournal(reorg *Reorg) (reorgJournal, error) {
+	journal := reorgJournal{
+		FromHeight: reorg.Attached[0].Header.Number,
+		Blocks:     make([]BlockFS, 0, len(reorg.Attached)),
+	}
+
+	for _, b := range reorg.Attached {
+		hash, err := b.Hash()
+		if err != nil {
+			return reorgJournal{}, err
+		}
+
+		journal.Blocks = append(journal.Blocks, BlockFS{Key: hash, Value: b})
+	}
+
+	return journal, nil
+}
+
+// rewriteMainChain replaces the stored main chain blocks from the journal height with the journal blocks,
+// the journal being persisted already. The diffs are the accountsDiff of every journal block.
+func (s *State) rewriteMainChain(journal reorgJournal, detached []Block, diffs []accountsDiff) error {
+	if err := s.store.Truncate(journal.FromHeight); err != nil {
+		return err
+	}
+
+	if s.txIndex != nil {
+		if err := s.txIndex.unindexBlocks(detached); err != nil {
+			return err
+		}
+	}
+
+	for i, blockFs := range journal.Blocks {
+		if err := s.persistBlock(blockFs.Key, blockFs.Value, diffs[i]); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(getReorgJournalFilePath(s.dataDir))
+}
+
+// completeReorg finishes the main chain rewrite of an interrupted reorg, if any.
+func completeReorg(dataDir string, store BlockStore) error {
+	path := getReorgJournalFilePath(dataDir)
+	if !fileExists(path) {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var journal reorgJournal
+	if err := json.Unmarshal(content, &journal); err != nil {
+		return fmt.Errorf("invalid reorg journal '%s': %w", path, err)
+	}
+
+	fmt.Printf("Completing an interrupted reorg, rewriting the main chain from height %d...\n", journal.FromHeight)
+
+	if err := store.Truncate(journal.FromHeight); err != nil {
+		return err
+	}
+
+	for _, blockFs := range journal.Blocks {
+		if err := store.Append(blockFs.Key, blockFs.Value); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(path)
+}
+
+// reload completes an interrupted reorg and rebuilds the State from the BlockStore, keeping the open
+// BlockStore and TX index. The side branches are dropped, the peers send them again if they're still relevant.
+func (s *State) reload() error {
+	if err := completeReorg(s.dataDir, s.store); err != nil {
+		return err
+	}
+
+	reloaded, err := newStateFromGenesis(s.dataDir, s.initialDifficulty(), s.store)
+	if err != nil {
+		return err
+	}
+	reloaded.snapshotInterval = s.snapshotInterval
+
+	if err := reloaded.loadLatestSnapshot(); err != nil {
+		return err
+	}
+
+	if err := reloaded.replay(reloaded.NextBlockNumber(), func(BlockFS) error { return nil }); err != nil {
+		return err
+	}
+
+	// The TX index notices its tip isn't part of the rewritten main chain and rebuilds itself
+	if s.txIndex != nil {
+		if err := s.txIndex.catchUp(s.store); err != nil {
+			return err
+		}
+	}
+	reloaded.txIndex = s.txIndex
+
+	*s = *reloaded
+
+	return nil
+}
+
+// writeReorgJournal persists the journal atomically and durably, before any block is removed.
+func writeReorgJournal(dataDir string, journal reorgJournal) error {
+	journalJson, err := json.Marshal(journal)
+	if err != nil {
+		return err
+	}
+
+	path := getReorgJournalFilePath(dataDir)
+
+	f, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(journalJson); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
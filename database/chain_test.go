@@ -0,0 +1,460 @@
+package database
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const testMiningDifficulty = 1
+
+func TestState_ReorgOntoHeavierBranch(t *testing.T) {
+	senderKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(senderKey.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	minerA := NewAccount("0x00000000000000000000000000000000000000aa")
+	minerB := NewAccount("0x00000000000000000000000000000000000000bb")
+
+	dataDir := setupTestDataDir(t, map[common.Address]uint{sender: 1000})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := signTestTx(t, NewBaseTx(sender, receiver, 10, 1, ""), senderKey)
+
+	// Main chain: 2 blocks mined by A, the first one with a transfer
+	a0 := mineTestBlock(t, Hash{}, 0, minerA, []SignedTx{tx})
+	a0Hash := addTestBlock(t, state, a0)
+	a1 := mineTestBlock(t, a0Hash, 1, minerA, nil)
+	addTestBlock(t, state, a1)
+
+	// Side branch: 3 blocks mined by B from the very beginning, without the transfer
+	b0 := mineTestBlock(t, Hash{}, 0, minerB, nil)
+	b0Hash := addTestBlock(t, state, b0)
+	b1 := mineTestBlock(t, b0Hash, 1, minerB, nil)
+	b1Hash := addTestBlock(t, state, b1)
+
+	if state.LatestBlock().Header.Miner != minerA {
+		t.Fatal("a side branch with equal work must not replace the main chain")
+	}
+
+	b2 := mineTestBlock(t, b1Hash, 2, minerB, nil)
+	b2Hash, reorg, err := state.ImportBlock(b2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reorg == nil {
+		t.Fatal("a heavier side branch must reorganize the main chain")
+	}
+
+	if len(reorg.Detached) != 2 || len(reorg.Attached) != 3 {
+		t.Fatalf("expected 2 detached and 3 attached blocks, got %d and %d", len(reorg.Detached), len(reorg.Attached))
+	}
+
+	orphaned := reorg.OrphanedTXs()
+	if len(orphaned) != 1 || orphaned[0].Nonce != tx.Nonce {
+		t.Fatalf("the transfer from the detached block should be orphaned, got %v", orphaned)
+	}
+
+	assertTestBalances(t, state, b2Hash, sender, receiver, minerA, minerB)
+
+	// The reorganized chain must be persisted
+	if err := state.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	assertTestBalances(t, reloaded, b2Hash, sender, receiver, minerA, minerB)
+}
+
+func TestState_ReorgFromFirstBlockNumberedOne(t *testing.T) {
+	minerA := NewAccount("0x00000000000000000000000000000000000000aa")
+	minerB := NewAccount("0x00000000000000000000000000000000000000bb")
+
+	dataDir := setupTestDataDir(t, map[common.Address]uint{minerA: 1000})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	// The node numbers the first block 1, competing first blocks must be kept as side branches
+	a1Hash := addTestBlock(t, state, mineTestBlock(t, Hash{}, 1, minerA, nil))
+	addTestBlock(t, state, mineTestBlock(t, a1Hash, 2, minerA, nil))
+
+	b1Hash := addTestBlock(t, state, mineTestBlock(t, Hash{}, 1, minerB, nil))
+	b2Hash := addTestBlock(t, state, mineTestBlock(t, b1Hash, 2, minerB, nil))
+
+	locator := state.BlockLocator()
+	if locator[len(locator)-1] != (Hash{}) {
+		t.Fatal("block locator must allow a reorg from the first block")
+	}
+
+	b3Hash, reorg, err := state.ImportBlock(mineTestBlock(t, b2Hash, 3, minerB, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reorg == nil || len(reorg.Detached) != 2 || len(reorg.Attached) != 3 {
+		t.Fatalf("heavier branch from the first block must reorganize the main chain, got %v", reorg)
+	}
+
+	if state.LatestBlockHash() != b3Hash || state.Balances[minerB] != 3*BlockReward {
+		t.Fatalf("main chain must end with block '%x', got '%x'", b3Hash, state.LatestBlockHash())
+	}
+
+	if state.Balances[minerA] != 1000 {
+		t.Errorf("miner A rewards must be rolled back, got %d", state.Balances[minerA])
+	}
+}
+
+func TestReorg_OrphanedTXsSkipsRewards(t *testing.T) {
+	senderKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(senderKey.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	minerA := NewAccount("0x00000000000000000000000000000000000000aa")
+	minerB := NewAccount("0x00000000000000000000000000000000000000bb")
+
+	tx := signTestTx(t, NewBaseTx(sender, receiver, 10, 1, ""), senderKey)
+
+	reorg := Reorg{
+		Detached: []Block{NewBlock(Hash{}, 0, 0, 1650000000, minerA, []SignedTx{NewRewardTx(minerA, BlockReward, 0, 1650000000), tx})},
+		Attached: []Block{NewBlock(Hash{}, 0, 0, 1650000000, minerB, []SignedTx{NewRewardTx(minerB, BlockReward, 0, 1650000000)})},
+	}
+
+	orphaned := reorg.OrphanedTXs()
+	if len(orphaned) != 1 || orphaned[0].IsReward() {
+		t.Fatalf("only the transfer must be orphaned, got %v", orphaned)
+	}
+}
+
+func TestState_InterruptedReorg(t *testing.T) {
+	minerA := NewAccount("0x00000000000000000000000000000000000000aa")
+	minerB := NewAccount("0x00000000000000000000000000000000000000bb")
+
+	// A single failed append is retried by reloading the State, a persistent failure is completed on open
+	for _, failures := range []int{1, 1000} {
+		dataDir := setupTestDataDir(t, map[common.Address]uint{minerA: 1000})
+		defer os.RemoveAll(dataDir)
+
+		store, err := OpenBlockStore(dataDir, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		failing := &failingAppendStore{BlockStore: store}
+
+		state, err := NewStateFromDisk(dataDir, testMiningDifficulty, failing)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		a0Hash := addTestBlock(t, state, mineTestBlock(t, Hash{}, 0, minerA, nil))
+		a1Hash := addTestBlock(t, state, mineTestBlock(t, a0Hash, 1, minerA, nil))
+		b0Hash := addTestBlock(t, state, mineTestBlock(t, Hash{}, 0, minerB, nil))
+		b1Hash := addTestBlock(t, state, mineTestBlock(t, b0Hash, 1, minerB, nil))
+
+		b2 := mineTestBlock(t, b1Hash, 2, minerB, nil)
+		b2Hash, err := b2.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		failing.failures = failures
+		_, reorg, err := state.ImportBlock(b2)
+
+		if failures == 1 {
+			if err != nil || reorg == nil || state.LatestBlockHash() != b2Hash {
+				t.Fatalf("reorg must be completed by reloading the State, got reorg %v, error: %v", reorg, err)
+			}
+
+			if state.Balances[minerB] != 3*BlockReward {
+				t.Fatalf("reloaded miner B balance must be %d, got %d", 3*BlockReward, state.Balances[minerB])
+			}
+		} else {
+			if err == nil || state.LatestBlockHash() != a1Hash {
+				t.Fatalf("interrupted reorg must fail and keep the main chain, got error: %v", err)
+			}
+
+			if !fileExists(getReorgJournalFilePath(dataDir)) {
+				t.Fatalf("interrupted reorg must keep its journal")
+			}
+		}
+
+		if err := state.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		reloaded, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if reloaded.LatestBlockHash() != b2Hash || reloaded.Balances[minerB] != 3*BlockReward {
+			t.Fatalf("reopened State must be on the heavier branch, got latest block '%x'", reloaded.LatestBlockHash())
+		}
+
+		if fileExists(getReorgJournalFilePath(dataDir)) {
+			t.Fatalf("completed reorg journal must be removed")
+		}
+
+		if err := reloaded.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestState_SideBlockWithForgedTxs(t *testing.T) {
+	senderKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(senderKey.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	minerA := NewAccount("0x00000000000000000000000000000000000000aa")
+	minerB := NewAccount("0x00000000000000000000000000000000000000bb")
+
+	forkTIP2 := uint64(0)
+	dataDir := setupTestDataDirWithGenesis(t, Genesis{Balances: map[common.Address]uint{sender: 1000}, ForkTIP2: &forkTIP2})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	a0 := NewBlock(Hash{}, 0, 0, 1650000000, minerA, nil)
+	if err := a0.CommitTxs(); err != nil {
+		t.Fatal(err)
+	}
+	addTestBlock(t, state, mineTestPreparedBlock(t, a0))
+
+	tx := signTestTx(t, NewBaseTx(sender, receiver, 10, 1, ""), senderKey)
+	b0 := NewBlock(Hash{}, 0, 0, 1650000000, minerB, []SignedTx{tx})
+	if err := b0.CommitTxs(); err != nil {
+		t.Fatal(err)
+	}
+	b0 = mineTestPreparedBlock(t, b0)
+
+	// Same header, so the same hash, but the committed TX is replaced
+	forged := b0
+	forged.Txs = []SignedTx{signTestTx(t, NewBaseTx(sender, minerB, 900, 1, ""), senderKey)}
+
+	forgedHash, err := forged.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := state.ImportBlock(forged); err == nil {
+		t.Fatal("side block with TXs not matching its TXs Merkle root must be rejected")
+	}
+
+	if state.IsKnownBlock(forgedHash) {
+		t.Fatal("rejected side block must not be stored")
+	}
+
+	b0Hash := addTestBlock(t, state, b0)
+	if b0Hash != forgedHash || !state.IsKnownBlock(b0Hash) {
+		t.Fatal("genuine side block must be stored under its hash")
+	}
+}
+
+func TestState_InvalidSideBranchEvicted(t *testing.T) {
+	senderKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(senderKey.PublicKey)
+	minerA := NewAccount("0x00000000000000000000000000000000000000aa")
+	minerB := NewAccount("0x00000000000000000000000000000000000000bb")
+	minerC := NewAccount("0x00000000000000000000000000000000000000cc")
+
+	dataDir := setupTestDataDir(t, map[common.Address]uint{sender: 1000})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	a0Hash := addTestBlock(t, state, mineTestBlock(t, Hash{}, 0, minerA, nil))
+	addTestBlock(t, state, mineTestBlock(t, a0Hash, 1, minerA, nil))
+
+	// The side branch overspends in its first block, which is only found out once it's applied
+	overspend := signTestTx(t, NewBaseTx(sender, minerB, 5000, 1, ""), senderKey)
+	b0Hash := addTestBlock(t, state, mineTestBlock(t, Hash{}, 0, minerB, []SignedTx{overspend}))
+	b1Hash := addTestBlock(t, state, mineTestBlock(t, b0Hash, 1, minerB, nil))
+	c1Hash := addTestBlock(t, state, mineTestBlock(t, b0Hash, 1, minerC, nil))
+
+	if _, _, err := state.ImportBlock(mineTestBlock(t, b1Hash, 2, minerB, nil)); err == nil {
+		t.Fatal("reorg onto an invalid side branch must fail")
+	}
+
+	for _, hash := range []Hash{b0Hash, b1Hash, c1Hash} {
+		if state.IsKnownBlock(hash) {
+			t.Fatalf("side block '%x' built on the invalid block must be evicted", hash)
+		}
+	}
+}
+
+// failingAppendStore fails the next failures block appends, like a full disk.
+type failingAppendStore struct {
+	BlockStore
+	failures int
+}
+
+func (s *failingAppendStore) Append(hash Hash, b Block) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("no space left on device")
+	}
+
+	return s.BlockStore.Append(hash, b)
+}
+
+func assertTestBalances(t *testing.T, state *State, tip Hash, sender, receiver, minerA, minerB common.Address) {
+	t.Helper()
+
+	if state.LatestBlockHash() != tip {
+		t.Fatalf("latest block must be '%x' not '%x'", tip, state.LatestBlockHash())
+	}
+
+	if state.Balances[sender] != 1000 {
+		t.Errorf("sender balance must be rolled back to 1000, got %d", state.Balances[sender])
+	}
+
+	if _, ok := state.Balances[receiver]; ok {
+		t.Errorf("receiver balance must be rolled back, got %d", state.Balances[receiver])
+	}
+
+	if _, ok := state.Balances[minerA]; ok {
+		t.Errorf("miner A rewards must be rolled back, got %d", state.Balances[minerA])
+	}
+
+	if state.Balances[minerB] != 3*BlockReward {
+		t.Errorf("miner B balance must be %d, got %d", 3*BlockReward, state.Balances[minerB])
+	}
+
+	if state.GetNextAccountNonce(sender) != 1 {
+		t.Errorf("sender nonce must be rolled back")
+	}
+}
+
+func setupTestDataDir(t *testing.T, balances map[common.Address]uint) string {
+	t.Helper()
+
+	return setupTestDataDirWithGenesis(t, Genesis{Balances: balances})
+}
+
+func setupTestDataDirWithGenesis(t *testing.T, gen Genesis) string {
+	t.Helper()
+
+	dataDir, err := ioutil.TempDir("/tmp", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genesisJson, err := json.Marshal(gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = InitDataDirIfNotExists(dataDir, genesisJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dataDir
+}
+
+func signTestTx(t *testing.T, tx Tx, privKey *ecdsa.PrivateKey) SignedTx {
+	t.Helper()
+
+	rawTx, err := tx.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txHash := sha256.Sum256(rawTx)
+	sig, err := crypto.Sign(txHash[:], privKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewSignedTx(tx, sig)
+}
+
+func mineTestBlock(t *testing.T, parent Hash, number uint64, miner common.Address, txs []SignedTx) Block {
+	t.Helper()
+
+	return mineTestPreparedBlock(t, NewBlock(parent, number, 0, 1650000000+number, miner, txs))
+}
+
+// mineTestPreparedBlock searches for a nonce the prepared block hash meets the PoW of its header with: the target
+// of the Bits, or of the Difficulty, testMiningDifficulty if not set, before TIP6 fork.
+func mineTestPreparedBlock(t *testing.T, b Block) Block {
+	t.Helper()
+
+	target := DifficultyTarget(testMiningDifficulty)
+	if b.Header.Difficulty != 0 {
+		target = DifficultyTarget(b.Header.Difficulty)
+	}
+
+	if b.Header.Bits != 0 {
+		var err error
+		if target, err = CompactToTarget(b.Header.Bits); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for b.Header.Nonce = 0; ; b.Header.Nonce++ {
+		hash, err := b.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if hash.MeetsPoW(&target, b.Header.Bits != 0) {
+			return b
+		}
+	}
+}
+
+func addTestBlock(t *testing.T, state *State, b Block) Hash {
+	t.Helper()
+
+	hash, reorg, err := state.ImportBlock(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reorg != nil {
+		t.Fatalf("unexpected reorg onto block '%x'", hash)
+	}
+
+	return hash
+}
@@ -0,0 +1,303 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+)
+
+const ForkTIP1 = "tip1"
+const ForkTIP2 = "tip2"
+const ForkTIP3 = "tip3"
+const ForkTIP4 = "tip4"
+const ForkTIP5 = "tip5"
+const ForkTIP6 = "tip6"
+const ForkTIP7 = "tip7"
+const ForkTIP8 = "tip8"
+const ForkTIP9 = "tip9"
+const ForkTIP10 = "tip10"
+const ForkTIP11 = "tip11"
+const ForkTIP12 = "tip12"
+
+// forkDefinition registers a consensus change, which a genesis schedules at a block height.
+//
+// Adding a consensus change means registering its fork here with the Rules flag it enables,
+// and checking that flag wherever the change applies.
+type forkDefinition struct {
+	name        string
+	description string
+
+	// legacyHeight reads the fork height from its dedicated Genesis field, nil for forks scheduled only by name
+	legacyHeight func(g Genesis) *uint64
+
+	enable func(r *Rules)
+}
+
+var forkDefinitions = []forkDefinition{
+	{
+		name:        ForkTIP1,
+		description: "TXs pay gas instead of the fixed TxFee",
+		legacyHeight: func(g Genesis) *uint64 {
+			// TIP1 predates the schedule and is active from the first block unless its height is set
+			height := g.ForkTIP1
+			return &height
+		},
+		enable: func(r *Rules) { r.IsTIP1 = true },
+	},
+	{
+		name:         ForkTIP2,
+		description:  "block headers commit the TXs Merkle root",
+		legacyHeight: func(g Genesis) *uint64 { return g.ForkTIP2 },
+		enable:       func(r *Rules) { r.IsTIP2 = true },
+	},
+	{
+		name:         ForkTIP3,
+		description:  "block headers commit the State root of the account balances and nonces",
+		legacyHeight: func(g Genesis) *uint64 { return g.ForkTIP3 },
+		enable:       func(r *Rules) { r.IsTIP3 = true },
+	},
+	{
+		name:         ForkTIP4,
+		description:  "TXs are signed for the chain ID",
+		legacyHeight: func(g Genesis) *uint64 { return g.ForkTIP4 },
+		enable:       func(r *Rules) { r.IsTIP4 = true },
+	},
+	{
+		name:        ForkTIP5,
+		description: "block headers commit their difficulty, retargeted toward the target block time",
+		enable:      func(r *Rules) { r.IsTIP5 = true },
+	},
+	{
+		name:        ForkTIP6,
+		description: "block headers commit a compact 256-bit PoW target, retargeted toward the target block time",
+		enable:      func(r *Rules) { r.IsTIP6 = true },
+	},
+	{
+		name:        ForkTIP7,
+		description: "blocks start with reward TXs minting the block reward and fees to their beneficiaries",
+		enable:      func(r *Rules) { r.IsTIP7 = true },
+	},
+	{
+		name:        ForkTIP8,
+		description: "TXs are applied in the block order instead of by time, miners order them by fee and sender nonce",
+		enable:      func(r *Rules) { r.IsTIP8 = true },
+	},
+	{
+		name:        ForkTIP9,
+		description: "block times must be after the median time of the previous blocks",
+		enable:      func(r *Rules) { r.IsTIP9 = true },
+	},
+	{
+		name:        ForkTIP10,
+		description: "blocks are limited by the block gas limit and maximum block size",
+		enable:      func(r *Rules) { r.IsTIP10 = true },
+	},
+	{
+		name:        ForkTIP11,
+		description: "TXs pay a max fee and tip instead of the gas price, the block base fee moves with block fullness and is burned",
+		enable:      func(r *Rules) { r.IsTIP11 = true },
+	},
+	{
+		name:        ForkTIP12,
+		description: "the first block's parent is the genesis hash instead of an empty hash",
+		enable:      func(r *Rules) { r.IsTIP12 = true },
+	},
+}
+
+// Fork is a registered consensus change and the height it activates at, nil if it's not scheduled.
+type Fork struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Height      *uint64 `json:"height"`
+}
+
+// ForkStatus is a Fork as seen from a block.
+type ForkStatus struct {
+	Fork
+	Active bool `json:"active"`
+}
+
+// ChainConfig holds the consensus parameters of a chain, derived from its genesis.
+type ChainConfig struct {
+	ChainID         uint64
+	TargetBlockTime uint64
+
+	// Difficulty is the genesis difficulty, the initial one of the TIP5 retargeting. 0 if the node's difficulty is used.
+	Difficulty uint
+
+	// BlockReward is the reward of the first block, the Reward of later ones follows the halvings
+	BlockReward     uint
+	HalvingInterval uint64
+	TailEmission    uint
+
+	// MaxSupply caps the GenesisSupply and the minted rewards, 0 if unlimited
+	MaxSupply     uint
+	GenesisSupply uint
+
+	// CoinbaseMaturity is the number of blocks the block rewards and fees are locked for, see MaturityHeight
+	CoinbaseMaturity uint64
+
+	// BlockGasLimit and MaxBlockSize limit the blocks since TIP10 fork
+	BlockGasLimit uint
+	MaxBlockSize  uint
+
+	// Forks are all the registered forks, in the registration order
+	Forks []Fork
+}
+
+// Rules are the consensus rules in force for a block.
+type Rules struct {
+	Number  uint64
+	ChainID uint64
+
+	// BlockReward minted by the block, see ChainConfig.Reward
+	BlockReward uint
+
+	// BaseFee per gas the block TXs burn since TIP11 fork, see State.NextBaseFee
+	BaseFee uint
+
+	IsTIP1  bool
+	IsTIP2  bool
+	IsTIP3  bool
+	IsTIP4  bool
+	IsTIP5  bool
+	IsTIP6  bool
+	IsTIP7  bool
+	IsTIP8  bool
+	IsTIP9  bool
+	IsTIP10 bool
+	IsTIP11 bool
+	IsTIP12 bool
+}
+
+// ChainConfig returns the consensus parameters and fork schedule of the genesis.
+//
+// A fork is scheduled either by its dedicated Genesis field, e.g. "fork_tip_2", or by name in "forks".
+func (g Genesis) ChainConfig() (ChainConfig, error) {
+	config := ChainConfig{
+		ChainID:          g.ChainID,
+		TargetBlockTime:  g.TargetBlockTime,
+		Difficulty:       g.Difficulty,
+		BlockReward:      g.BlockReward,
+		HalvingInterval:  g.HalvingInterval,
+		TailEmission:     g.TailEmission,
+		MaxSupply:        g.MaxSupply,
+		CoinbaseMaturity: g.CoinbaseMaturity,
+		BlockGasLimit:    g.BlockGasLimit,
+		MaxBlockSize:     g.MaxBlockSize,
+		Forks:            make([]Fork, 0, len(forkDefinitions)),
+	}
+
+	for _, balance := range g.Balances {
+		config.GenesisSupply += balance
+	}
+
+	if config.BlockReward == 0 {
+		config.BlockReward = BlockReward
+	}
+
+	if config.BlockGasLimit == 0 {
+		config.BlockGasLimit = DefaultBlockGasLimit
+	}
+
+	if config.MaxBlockSize == 0 {
+		config.MaxBlockSize = DefaultMaxBlockSize
+	}
+
+	for name := range g.Forks {
+		if !isRegisteredFork(name) {
+			return ChainConfig{}, fmt.Errorf("unknown fork '%s'", name)
+		}
+	}
+
+	for _, def := range forkDefinitions {
+		fork := Fork{Name: def.name, Description: def.description}
+
+		var legacy *uint64
+		if def.legacyHeight != nil {
+			legacy = def.legacyHeight(g)
+		}
+
+		if height, ok := g.Forks[def.name]; ok {
+			if legacy != nil && (def.name != ForkTIP1 || *legacy != 0) {
+				return ChainConfig{}, fmt.Errorf("fork '%s' is scheduled twice", def.name)
+			}
+			fork.Height = &height
+		} else {
+			fork.Height = legacy
+		}
+
+		config.Forks = append(config.Forks, fork)
+	}
+
+	return config, nil
+}
+
+// Rules returns the consensus rules of the block at the given height.
+func (c ChainConfig) Rules(number uint64) Rules {
+	rules := Rules{
+		Number:      number,
+		ChainID:     c.ChainID,
+		BlockReward: c.Reward(number),
+	}
+
+	for i, fork := range c.Forks {
+		if fork.Height != nil && number >= *fork.Height {
+			forkDefinitions[i].enable(&rules)
+		}
+	}
+
+	return rules
+}
+
+// BlockRules returns the consensus rules the block was applied with, including the base fee it committed.
+func (c ChainConfig) BlockRules(b Block) Rules {
+	rules := c.Rules(b.Header.Number)
+	rules.BaseFee = b.Header.BaseFee
+
+	return rules
+}
+
+// ForkHeight returns the height the fork activates at, nil if it's not scheduled.
+func (c ChainConfig) ForkHeight(name string) *uint64 {
+	for _, fork := range c.Forks {
+		if fork.Name == name {
+			return fork.Height
+		}
+	}
+
+	return nil
+}
+
+// Schedule returns the forks ordered by activation height, marking the ones active at the block.
+// Forks which are not scheduled come last.
+func (c ChainConfig) Schedule(number uint64) []ForkStatus {
+	schedule := make([]ForkStatus, 0, len(c.Forks))
+
+	for _, fork := range c.Forks {
+		schedule = append(schedule, ForkStatus{
+			Fork:   fork,
+			Active: fork.Height != nil && number >= *fork.Height,
+		})
+	}
+
+	sort.SliceStable(schedule, func(i, j int) bool {
+		hi, hj := schedule[i].Height, schedule[j].Height
+		if hi == nil || hj == nil {
+			return hj == nil && hi != nil
+		}
+
+		return *hi < *hj
+	})
+
+	return schedule
+}
+
+func isRegisteredFork(name string) bool {
+	for _, def := range forkDefinitions {
+		if def.name == name {
+			return true
+		}
+	}
+
+	return false
+}
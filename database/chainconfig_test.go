@@ -0,0 +1,96 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGenesis_ChainConfig(t *testing.T) {
+	var gen Genesis
+
+	err := json.Unmarshal([]byte(`{
+		"chain_id": 7,
+		"fork_tip_1": 2,
+		"fork_tip_2": 3,
+		"forks": {"tip3": 5}
+	}`), &gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := gen.ChainConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.BlockReward != BlockReward {
+		t.Fatalf("block reward must default to %d, got %d", BlockReward, config.BlockReward)
+	}
+
+	expected := map[uint64]Rules{
+		0: {Number: 0},
+		2: {Number: 2, IsTIP1: true},
+		3: {Number: 3, IsTIP1: true, IsTIP2: true},
+		5: {Number: 5, IsTIP1: true, IsTIP2: true, IsTIP3: true},
+	}
+
+	for number, rules := range expected {
+		rules.ChainID = 7
+		rules.BlockReward = BlockReward
+
+		if got := config.Rules(number); got != rules {
+			t.Errorf("block %d rules must be %+v, got %+v", number, rules, got)
+		}
+	}
+
+	schedule := config.Schedule(3)
+
+	// The scheduled forks come first, by height, followed by the unscheduled ones
+	names := []string{ForkTIP1, ForkTIP2, ForkTIP3}
+	active := []bool{true, true, false}
+
+	if len(schedule) != len(forkDefinitions) {
+		t.Fatalf("schedule must list all the %d forks, got %d", len(forkDefinitions), len(schedule))
+	}
+
+	for i, fork := range schedule {
+		if i >= len(names) {
+			if fork.Height != nil || fork.Active {
+				t.Errorf("fork '%s' must not be scheduled", fork.Name)
+			}
+			continue
+		}
+
+		if fork.Name != names[i] || fork.Active != active[i] {
+			t.Errorf("fork %d must be '%s' active %t, got '%s' active %t", i, names[i], active[i], fork.Name, fork.Active)
+		}
+	}
+}
+
+func TestGenesis_ChainConfigInvalidForks(t *testing.T) {
+	forkTIP2 := uint64(1)
+
+	tests := map[string]Genesis{
+		"unknown fork":    {Forks: map[string]uint64{"tip99": 1}},
+		"scheduled twice": {ForkTIP2: &forkTIP2, Forks: map[string]uint64{ForkTIP2: 1}},
+		"tip1 twice":      {ForkTIP1: 2, Forks: map[string]uint64{ForkTIP1: 2}},
+	}
+
+	for name, gen := range tests {
+		if _, err := gen.ChainConfig(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// TIP1 is active from the first block by default, so scheduling it by name moves it
+	gen := Genesis{Forks: map[string]uint64{ForkTIP1: 4}}
+
+	config, err := gen.ChainConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Rules(3).IsTIP1 || !config.Rules(4).IsTIP1 {
+		t.Fatalf("fork '%s' must activate at block 4", ForkTIP1)
+	}
+}
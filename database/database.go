@@ -1,92 +1,57 @@
 package database
 
 import (
-	"bufio"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"reflect"
 )
 
-func GetBlocksAfter(blockHash Hash, dataDir string) ([]Block, error) {
-	f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_RDONLY, 0600)
-	if err != nil {
-		return nil, err
-	}
-
+func GetBlocksAfter(blockHash Hash, state *State) ([]Block, error) {
 	blocks := make([]Block, 0)
 
-	var shouldStartCollecting bool
+	fromHeight := uint64(0)
 
-	if reflect.DeepEqual(blockHash, Hash{}) {
-		shouldStartCollecting = true
-	}
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			return nil, err
-		}
-
-		var blockFS BlockFS
-
-		err = json.Unmarshal(scanner.Bytes(), &blockFS)
+	if !blockHash.IsEmpty() {
+		blockFs, err := state.store.BlockByHash(blockHash)
 		if err != nil {
 			return nil, err
 		}
 
-		if shouldStartCollecting {
-			blocks = append(blocks, blockFS.Value)
-			continue
-		}
+		fromHeight = blockFs.Value.Header.Number + 1
+	}
 
-		if blockHash == blockFS.Key {
-			shouldStartCollecting = true
-		}
+	err := state.store.Iterate(fromHeight, func(blockFs BlockFS) error {
+		blocks = append(blocks, blockFs.Value)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return blocks, nil
 }
 
 // GetBlockByHeightOrHash returns the requested block by hash or height.
-// It uses cached data in the State struct (HashCache / HeightCache)
-func GetBlockByHeightOrHash(state *State, height uint64, hash, dataDir string) (BlockFS, error) {
+func GetBlockByHeightOrHash(state *State, height uint64, hash string) (BlockFS, error) {
 	var block BlockFS
+	var err error
 
-	key, ok := state.HeightCache[height]
 	if hash != "" {
-		key, ok = state.HashCache[hash]
-	}
-
-	if !ok {
-		if hash != "" {
+		var h Hash
+		if err := h.UnmarshalText([]byte(hash)); err != nil {
 			return block, fmt.Errorf("invalid hash: '%v", hash)
 		}
-		return block, fmt.Errorf("invalid height: '%v", height)
-	}
 
-	f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_RDONLY, 0600)
-	if err != nil {
-		return block, err
+		block, err = state.store.BlockByHash(h)
+	} else {
+		block, err = state.store.BlockByHeight(height)
 	}
-	defer f.Close()
 
-	_, err = f.Seek(key, 0)
-	if err != nil {
-		return block, err
-	}
-
-	scanner := bufio.NewScanner(f)
-	if scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			return block, err
-		}
-
-		err = json.Unmarshal(scanner.Bytes(), &block)
-		if err != nil {
-			return block, err
+	if errors.Is(err, ErrBlockNotFound) {
+		if hash != "" {
+			return block, fmt.Errorf("invalid hash: '%v", hash)
 		}
+		return block, fmt.Errorf("invalid height: '%v", height)
 	}
 
-	return block, nil
+	return block, err
 }
@@ -0,0 +1,157 @@
+package database
+
+import (
+	"math/big"
+)
+
+// DifficultyRetargetInterval is the number of blocks the difficulty is kept for since TIP5 fork,
+// before it's retargeted from their timestamps.
+const DifficultyRetargetInterval = 10
+
+// difficultyRetargetThreshold is how many times off the target block time the last interval blocks must be
+// for the difficulty to change. Every difficulty step requires one more zero byte, 256 times more hashes,
+// so the difficulty only moves when the adjusted one gets the block time closer to the target.
+const difficultyRetargetThreshold = 16
+
+// maxRetargetFactor limits how many times easier or harder a single retarget makes the TIP6 target.
+const maxRetargetFactor = 4
+
+// NextDifficulty returns the difficulty the next block must be mined with.
+//
+// Since TIP5 fork the difficulty is committed in the block header and retargeted every
+// DifficultyRetargetInterval blocks, comparing the time the last interval took with the target block time.
+func (s *State) NextDifficulty() uint {
+	rules := s.Rules()
+	if !rules.IsTIP5 {
+		return s.miningDifficulty
+	}
+
+	difficulty := s.latestBlock.Header.Difficulty
+	if difficulty == 0 {
+		// The first TIP5 block starts from the genesis difficulty, never from the node's one
+		difficulty = s.config.Difficulty
+	}
+
+	if rules.Number%DifficultyRetargetInterval != 0 || len(s.blockTimes) < 2 {
+		return difficulty
+	}
+
+	return retargetDifficulty(difficulty, s.blockTimes, s.config.TargetBlockTime)
+}
+
+// initialDifficulty returns the difficulty the first block is mined with, the replays from the genesis start from.
+func (s *State) initialDifficulty() uint {
+	if s.config.Difficulty != 0 {
+		return s.config.Difficulty
+	}
+
+	// Without a genesis difficulty neither TIP5 nor TIP6 is scheduled, the node's difficulty is never retargeted
+	return s.miningDifficulty
+}
+
+// retargetDifficulty adjusts the difficulty by a step if the blocks mined at the given times,
+// oldest first, were too fast or too slow.
+func retargetDifficulty(difficulty uint, times []uint64, targetBlockTime uint64) uint {
+	from, to := times[0], times[len(times)-1]
+	expected := targetBlockTime * uint64(len(times)-1)
+
+	elapsed := uint64(0)
+	if to > from {
+		elapsed = to - from
+	}
+
+	if elapsed*difficultyRetargetThreshold < expected && difficulty < maxMiningDifficulty {
+		return difficulty + 1
+	}
+
+	if elapsed > expected*difficultyRetargetThreshold && difficulty > 1 {
+		return difficulty - 1
+	}
+
+	return difficulty
+}
+
+// NextBits returns the compact PoW target the next block must be mined with since TIP6 fork.
+//
+// The target is retargeted every DifficultyRetargetInterval blocks in proportion to the time the last
+// interval took compared to the target block time, by at most maxRetargetFactor.
+func (s *State) NextBits() uint32 {
+	bits := s.latestBlock.Header.Bits
+	if bits == 0 {
+		// The first TIP6 block starts from the target of the difficulty the blocks were mined with so far
+		return TargetToCompact(DifficultyTarget(s.NextDifficulty()))
+	}
+
+	if s.NextBlockNumber()%DifficultyRetargetInterval != 0 || len(s.blockTimes) < 2 {
+		return bits
+	}
+
+	return retargetBits(bits, s.blockTimes, s.config.TargetBlockTime)
+}
+
+// retargetBits scales the compact target by the time the blocks mined at the given times, oldest first,
+// took compared to the target block time.
+func retargetBits(bits uint32, times []uint64, targetBlockTime uint64) uint32 {
+	target, err := CompactToTarget(bits)
+	if err != nil {
+		return bits
+	}
+
+	from, to := times[0], times[len(times)-1]
+	expected := targetBlockTime * uint64(len(times)-1)
+
+	elapsed := uint64(0)
+	if to > from {
+		elapsed = to - from
+	}
+
+	if elapsed < expected/maxRetargetFactor {
+		elapsed = expected / maxRetargetFactor
+	}
+
+	if elapsed > expected*maxRetargetFactor {
+		elapsed = expected * maxRetargetFactor
+	}
+
+	if elapsed == 0 {
+		elapsed = 1
+	}
+
+	next := new(big.Int).Mul(target.Big(), new(big.Int).SetUint64(elapsed))
+	next.Div(next, new(big.Int).SetUint64(expected))
+
+	if next.Sign() == 0 {
+		next.SetInt64(1)
+	}
+
+	return TargetToCompact(targetFromBig(next))
+}
+
+// blockTarget returns the PoW target the block claims to be mined with, the target of the given difficulty
+// for blocks committing neither Bits nor Difficulty.
+func blockTarget(b Block, miningDifficulty uint) (Target, error) {
+	if b.Header.Bits != 0 {
+		return CompactToTarget(b.Header.Bits)
+	}
+
+	if b.Header.Difficulty != 0 {
+		return DifficultyTarget(b.Header.Difficulty), nil
+	}
+
+	return DifficultyTarget(miningDifficulty), nil
+}
+
+// appendBlockTime returns the times of the latest blocks ending with the given one, up to
+// DifficultyRetargetInterval + 1 the difficulty is retargeted from.
+//
+// The times are copied, so the States sharing the previous ones are not affected.
+func appendBlockTime(times []uint64, time uint64) []uint64 {
+	if len(times) > DifficultyRetargetInterval {
+		times = times[len(times)-DifficultyRetargetInterval:]
+	}
+
+	next := make([]uint64, 0, len(times)+1)
+	next = append(next, times...)
+
+	return append(next, time)
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestRetargetDifficulty(t *testing.T) {
+	tests := []struct {
+		name       string
+		difficulty uint
+		elapsed    uint64
+		expected   uint
+	}{
+		{"on target", 2, 600, 2},
+		{"slightly fast", 2, 100, 2},
+		{"slightly slow", 2, 6000, 2},
+		{"too fast", 2, 30, 3},
+		{"too slow", 2, 10000, 1},
+		{"too slow at the minimum", 1, 10000, 1},
+		{"too fast at the maximum", maxMiningDifficulty, 0, maxMiningDifficulty},
+	}
+
+	for _, tc := range tests {
+		// 11 timestamps of 10 blocks expected to take 600 seconds
+		times := make([]uint64, DifficultyRetargetInterval+1)
+		for i := range times {
+			times[i] = 1650000000 + tc.elapsed*uint64(i)/DifficultyRetargetInterval
+		}
+
+		if got := retargetDifficulty(tc.difficulty, times, 60); got != tc.expected {
+			t.Errorf("%s: difficulty must be %d, got %d", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestState_DifficultyRetarget(t *testing.T) {
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+
+	// Blocks mined every second are way faster than the 60 seconds target
+	dataDir := setupTestDataDirWithGenesis(t, Genesis{
+		Balances:        map[common.Address]uint{miner: 1000},
+		TargetBlockTime: 60,
+		Difficulty:      testMiningDifficulty,
+		Forks:           map[string]uint64{ForkTIP5: 0},
+	})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	mineBlock := func(parent Hash, number uint64, difficulty uint) Block {
+		b := NewBlock(parent, number, 0, 1650000000+number, miner, nil)
+		b.Header.Difficulty = difficulty
+
+		return mineTestPreparedBlock(t, b)
+	}
+
+	parent := Hash{}
+	for number := uint64(0); number < DifficultyRetargetInterval; number++ {
+		if difficulty := state.NextDifficulty(); difficulty != testMiningDifficulty {
+			t.Fatalf("block %d difficulty must be %d, got %d", number, testMiningDifficulty, difficulty)
+		}
+
+		parent = addTestBlock(t, state, mineBlock(parent, number, testMiningDifficulty))
+	}
+
+	if difficulty := state.NextDifficulty(); difficulty != testMiningDifficulty+1 {
+		t.Fatalf("difficulty must be retargeted to %d, got %d", testMiningDifficulty+1, difficulty)
+	}
+
+	stale := mineBlock(parent, DifficultyRetargetInterval, testMiningDifficulty)
+	if _, err := state.AddBlock(stale); err == nil {
+		t.Fatalf("block committing the previous difficulty must be rejected")
+	}
+
+	addTestBlock(t, state, mineBlock(parent, DifficultyRetargetInterval, testMiningDifficulty+1))
+
+	if _, err := state.CreateSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := state.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The replayed State retargets the same way, starting from the genesis difficulty whatever the node's one
+	state, err = NewStateFromDisk(dataDir, testMiningDifficulty+2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if difficulty := state.MiningDifficulty(); difficulty != testMiningDifficulty+1 {
+		t.Fatalf("replayed difficulty must be %d, got %d", testMiningDifficulty+1, difficulty)
+	}
+
+	if difficulty := state.NextDifficulty(); difficulty != testMiningDifficulty+1 {
+		t.Fatalf("difficulty must be kept until the next retarget, got %d", difficulty)
+	}
+
+	if err := state.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := VerifySnapshots(dataDir, testMiningDifficulty+2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := results[DifficultyRetargetInterval]; err != nil {
+		t.Fatalf("snapshot with the retargeted difficulty must match the replay, got: %s", err)
+	}
+}
@@ -0,0 +1,568 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var fileIndexHeightPrefix = []byte("n")
+var fileIndexHashPrefix = []byte("h")
+var fileIndexMetaKey = []byte("meta")
+
+// ErrCorruptBlockIndex is returned when the block.db index doesn't match the block.db file.
+// The index can be rebuilt with RebuildBlockIndex.
+var ErrCorruptBlockIndex = errors.New("block index is corrupt, rebuild it with 'gc db reindex'")
+
+// blockRecordHeaderLen is the length of the "<json length> <json crc32> " record prefix.
+const blockRecordHeaderLen = 18
+
+// tornRecordError is returned by scan when the last record of the block.db is incomplete or damaged.
+type tornRecordError struct {
+	filePosition int64
+	length       int64
+	err          error
+}
+
+func (e *tornRecordError) Error() string {
+	return fmt.Sprintf("torn block.db record of %d bytes at offset %d: %s", e.length, e.filePosition, e.err)
+}
+
+// FileBlockStore keeps the blocks as records in the block.db file, one per line.
+//
+// Every record is the BlockFS JSON prefixed by its length and CRC-32 checksum, so a record torn
+// by a crash is detected and dropped when the store is opened. Plain JSON lines written by
+// older versions are still readable.
+//
+// Blocks are looked up by their file position stored in an on-disk hash -> offset and height -> offset index,
+// which is updated together with every appended block and verified when the store is opened.
+type FileBlockStore struct {
+	file *os.File
+	size int64
+
+	index *leveldb.DB
+	meta  fileIndexMeta
+}
+
+// fileIndexMeta describes the part of the block.db covered by the index.
+type fileIndexMeta struct {
+	Count     uint64
+	Size      int64
+	TipOffset int64
+	TipHash   Hash
+}
+
+func NewFileBlockStore(dataDir string) (*FileBlockStore, error) {
+	if fileExists(getBlocksLevelDBDirPath(dataDir)) {
+		return nil, fmt.Errorf("data dir '%s' uses the '%s' db engine", dataDir, LevelDBEngine)
+	}
+
+	f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	isNewIndex := !fileExists(getBlocksIndexDirPath(dataDir))
+
+	index, err := leveldb.OpenFile(getBlocksIndexDirPath(dataDir), nil)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	store := &FileBlockStore{
+		file:  f,
+		size:  info.Size(),
+		index: index,
+	}
+
+	if isNewIndex {
+		fmt.Printf("Building the block.db index...\n")
+	}
+
+	err = store.loadIndex()
+	if err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// RebuildBlockIndex drops the block.db index and indexes the whole block.db again.
+func RebuildBlockIndex(dataDir string) error {
+	if fileExists(getBlocksLevelDBDirPath(dataDir)) {
+		return fmt.Errorf("data dir '%s' uses the '%s' db engine which doesn't need a block index", dataDir, LevelDBEngine)
+	}
+
+	if err := os.RemoveAll(getBlocksIndexDirPath(dataDir)); err != nil {
+		return err
+	}
+
+	store, err := NewFileBlockStore(dataDir)
+	if err != nil {
+		return err
+	}
+
+	return store.Close()
+}
+
+// Append returns only after the block is durably written, the index is caught up from the block.db if lost.
+func (fs *FileBlockStore) Append(hash Hash, b Block) error {
+	record, err := encodeBlockRecord(BlockFS{Key: hash, Value: b})
+	if err != nil {
+		return err
+	}
+
+	filePosition := fs.size
+
+	_, err = fs.file.Write(record)
+	if err != nil {
+		return err
+	}
+	fs.size += int64(len(record))
+
+	if err := fs.file.Sync(); err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	fs.indexBlock(batch, hash, b.Header.Number, filePosition)
+
+	return fs.index.Write(batch, nil)
+}
+
+func (fs *FileBlockStore) BlockByHash(hash Hash) (BlockFS, error) {
+	value, err := fs.index.Get(fileIndexHashKey(hash), nil)
+	if err == leveldb.ErrNotFound {
+		return BlockFS{}, ErrBlockNotFound
+	}
+	if err != nil {
+		return BlockFS{}, err
+	}
+
+	return fs.readAt(int64(binary.BigEndian.Uint64(value)))
+}
+
+func (fs *FileBlockStore) BlockByHeight(height uint64) (BlockFS, error) {
+	filePosition, _, err := fs.heightEntry(height)
+	if err != nil {
+		return BlockFS{}, err
+	}
+
+	return fs.readAt(filePosition)
+}
+
+func (fs *FileBlockStore) Iterate(fromHeight uint64, fn func(BlockFS) error) error {
+	_, filePosition, _, err := fs.firstHeightEntry(fromHeight)
+	if errors.Is(err, ErrBlockNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return fs.scan(filePosition, func(blockFs BlockFS, _ int64) error {
+		return fn(blockFs)
+	})
+}
+
+func (fs *FileBlockStore) Truncate(fromHeight uint64) error {
+	_, filePosition, _, err := fs.firstHeightEntry(fromHeight)
+	if errors.Is(err, ErrBlockNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := fs.truncateFile(filePosition); err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+
+	iter := fs.index.NewIterator(&util.Range{
+		Start: fileIndexHeightKey(fromHeight),
+		Limit: util.BytesPrefix(fileIndexHeightPrefix).Limit,
+	}, nil)
+	for iter.Next() {
+		var hash Hash
+		copy(hash[:], iter.Value()[8:])
+
+		batch.Delete(append([]byte{}, iter.Key()...))
+		batch.Delete(fileIndexHashKey(hash))
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	meta, err := fs.metaBelow(fromHeight, filePosition)
+	if err != nil {
+		return err
+	}
+
+	fs.meta = meta
+	batch.Put(fileIndexMetaKey, meta.encode())
+
+	return fs.index.Write(batch, nil)
+}
+
+func (fs *FileBlockStore) Close() error {
+	indexErr := fs.index.Close()
+
+	if err := fs.file.Close(); err != nil {
+		return err
+	}
+
+	return indexErr
+}
+
+// loadIndex verifies the index matches the block.db, drops indexed blocks cut from its end and indexes blocks
+// appended after the last indexed one.
+func (fs *FileBlockStore) loadIndex() error {
+	value, err := fs.index.Get(fileIndexMetaKey, nil)
+	if err != nil && err != leveldb.ErrNotFound {
+		return err
+	}
+
+	if err == nil {
+		if err := fs.meta.decode(value); err != nil {
+			return fmt.Errorf("%w: %s", ErrCorruptBlockIndex, err)
+		}
+	}
+
+	if fs.meta.Size > fs.size {
+		if err := fs.dropIndexPastFile(); err != nil {
+			return err
+		}
+	}
+
+	if fs.meta.Size > fs.size {
+		return fmt.Errorf("%w: indexed %d bytes but block.db has only %d", ErrCorruptBlockIndex, fs.meta.Size, fs.size)
+	}
+
+	if fs.meta.Count > 0 {
+		tip, err := fs.readAt(fs.meta.TipOffset)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrCorruptBlockIndex, err)
+		}
+
+		if tip.Key != fs.meta.TipHash || tip.Value.Header.Number != fs.meta.Count-1 {
+			return fmt.Errorf("%w: indexed tip '%x' doesn't match block.db", ErrCorruptBlockIndex, fs.meta.TipHash)
+		}
+	}
+
+	if fs.meta.Size == fs.size {
+		return nil
+	}
+
+	batch := new(leveldb.Batch)
+
+	err = fs.scan(fs.meta.Size, func(blockFs BlockFS, filePosition int64) error {
+		fs.indexBlock(batch, blockFs.Key, blockFs.Value.Header.Number, filePosition)
+		return nil
+	})
+
+	var torn *tornRecordError
+	if errors.As(err, &torn) {
+		fmt.Printf("WARNING: dropping the last block.db record, it was not completely written: %s\n", torn)
+
+		err = fs.truncateFile(torn.filePosition)
+	}
+	if err != nil {
+		return err
+	}
+
+	fs.meta.Size = fs.size
+	batch.Put(fileIndexMetaKey, fs.meta.encode())
+
+	return fs.index.Write(batch, nil)
+}
+
+// dropIndexPastFile forgets the indexed blocks the block.db no longer has, when a crash cut the file
+// before the index write dropping them was durable.
+func (fs *FileBlockStore) dropIndexPastFile() error {
+	batch := new(leveldb.Batch)
+	dropped := 0
+	firstDropped := uint64(0)
+	size := int64(0)
+
+	iter := fs.index.NewIterator(util.BytesPrefix(fileIndexHeightPrefix), nil)
+	for iter.Next() {
+		filePosition := int64(binary.BigEndian.Uint64(iter.Value()[:8]))
+		if filePosition < fs.size {
+			continue
+		}
+
+		if dropped == 0 {
+			firstDropped = binary.BigEndian.Uint64(iter.Key()[len(fileIndexHeightPrefix):])
+			size = filePosition
+		}
+
+		var hash Hash
+		copy(hash[:], iter.Value()[8:])
+
+		batch.Delete(append([]byte{}, iter.Key()...))
+		batch.Delete(fileIndexHashKey(hash))
+		dropped++
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	if dropped == 0 {
+		return nil
+	}
+
+	meta, err := fs.metaBelow(firstDropped, size)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("WARNING: dropping %d indexed blocks past the end of block.db\n", dropped)
+
+	fs.meta = meta
+	batch.Put(fileIndexMetaKey, meta.encode())
+
+	return fs.index.Write(batch, nil)
+}
+
+// metaBelow returns the index meta covering the blocks below the given height, the first size bytes of the block.db.
+func (fs *FileBlockStore) metaBelow(height uint64, size int64) (fileIndexMeta, error) {
+	meta := fileIndexMeta{Size: size}
+
+	iter := fs.index.NewIterator(&util.Range{
+		Start: fileIndexHeightKey(0),
+		Limit: fileIndexHeightKey(height),
+	}, nil)
+	defer iter.Release()
+
+	if !iter.Last() {
+		return meta, iter.Error()
+	}
+
+	meta.Count = binary.BigEndian.Uint64(iter.Key()[len(fileIndexHeightPrefix):]) + 1
+	meta.TipOffset = int64(binary.BigEndian.Uint64(iter.Value()[:8]))
+	copy(meta.TipHash[:], iter.Value()[8:])
+
+	return meta, nil
+}
+
+// truncateFile durably cuts the block.db at the file position.
+func (fs *FileBlockStore) truncateFile(filePosition int64) error {
+	if err := fs.file.Truncate(filePosition); err != nil {
+		return err
+	}
+	fs.size = filePosition
+
+	return fs.file.Sync()
+}
+
+// indexBlock adds the block position to the batch and moves the indexed tip onto it.
+func (fs *FileBlockStore) indexBlock(batch *leveldb.Batch, hash Hash, number uint64, filePosition int64) {
+	batch.Put(fileIndexHashKey(hash), encodeUint64(uint64(filePosition)))
+	batch.Put(fileIndexHeightKey(number), append(encodeUint64(uint64(filePosition)), hash[:]...))
+
+	fs.meta = fileIndexMeta{
+		Count:     number + 1,
+		Size:      fs.size,
+		TipOffset: filePosition,
+		TipHash:   hash,
+	}
+	batch.Put(fileIndexMetaKey, fs.meta.encode())
+}
+
+// heightEntry returns the file position and hash of the block at the given height.
+func (fs *FileBlockStore) heightEntry(height uint64) (int64, Hash, error) {
+	var hash Hash
+
+	value, err := fs.index.Get(fileIndexHeightKey(height), nil)
+	if err == leveldb.ErrNotFound {
+		return 0, hash, ErrBlockNotFound
+	}
+	if err != nil {
+		return 0, hash, err
+	}
+
+	copy(hash[:], value[8:])
+
+	return int64(binary.BigEndian.Uint64(value[:8])), hash, nil
+}
+
+// firstHeightEntry returns the height, file position and hash of the first indexed block at or above the given height,
+// the chain doesn't have to start at height 0.
+func (fs *FileBlockStore) firstHeightEntry(fromHeight uint64) (uint64, int64, Hash, error) {
+	var hash Hash
+
+	iter := fs.index.NewIterator(&util.Range{
+		Start: fileIndexHeightKey(fromHeight),
+		Limit: util.BytesPrefix(fileIndexHeightPrefix).Limit,
+	}, nil)
+	defer iter.Release()
+
+	if !iter.Next() {
+		if err := iter.Error(); err != nil {
+			return 0, 0, hash, err
+		}
+
+		return 0, 0, hash, ErrBlockNotFound
+	}
+
+	copy(hash[:], iter.Value()[8:])
+	height := binary.BigEndian.Uint64(iter.Key()[len(fileIndexHeightPrefix):])
+
+	return height, int64(binary.BigEndian.Uint64(iter.Value()[:8])), hash, nil
+}
+
+func (fs *FileBlockStore) readAt(filePosition int64) (BlockFS, error) {
+	reader := bufio.NewReader(io.NewSectionReader(fs.file, filePosition, fs.size-filePosition))
+
+	record, err := reader.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return BlockFS{}, err
+	}
+
+	return decodeBlockRecord(record)
+}
+
+// scan reads the blocks from the file position until the end of the file.
+//
+// A damaged last record is reported as a tornRecordError, damaged records followed by others are corruption.
+func (fs *FileBlockStore) scan(filePosition int64, fn func(blockFs BlockFS, filePosition int64) error) error {
+	reader := bufio.NewReader(io.NewSectionReader(fs.file, filePosition, fs.size-filePosition))
+
+	for {
+		record, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(record) == 0 {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		recordLen := int64(len(record))
+		isLast := filePosition+recordLen == fs.size
+
+		if len(bytes.TrimSpace(record)) > 0 {
+			blockFs, decodeErr := decodeBlockRecord(record)
+			if decodeErr == nil && err == io.EOF {
+				decodeErr = fmt.Errorf("missing record terminator")
+			}
+
+			if decodeErr != nil && isLast {
+				return &tornRecordError{filePosition: filePosition, length: recordLen, err: decodeErr}
+			}
+			if decodeErr != nil {
+				return fmt.Errorf("corrupt block.db record at offset %d: %w", filePosition, decodeErr)
+			}
+
+			if err := fn(blockFs, filePosition); err != nil {
+				return err
+			}
+		}
+
+		filePosition += recordLen
+	}
+}
+
+// encodeBlockRecord serializes the block as a "<json length> <json crc32> <json>\n" block.db record.
+func encodeBlockRecord(blockFs BlockFS) ([]byte, error) {
+	blockFsJson, err := json.Marshal(blockFs)
+	if err != nil {
+		return nil, err
+	}
+
+	record := make([]byte, 0, blockRecordHeaderLen+len(blockFsJson)+1)
+	record = append(record, fmt.Sprintf("%08x %08x ", len(blockFsJson), crc32.ChecksumIEEE(blockFsJson))...)
+	record = append(record, blockFsJson...)
+
+	return append(record, '\n'), nil
+}
+
+// decodeBlockRecord parses and verifies a block.db record, accepting legacy plain JSON records.
+func decodeBlockRecord(record []byte) (BlockFS, error) {
+	var blockFs BlockFS
+
+	record = bytes.TrimSuffix(record, []byte{'\n'})
+
+	if len(record) > 0 && record[0] == '{' {
+		err := json.Unmarshal(record, &blockFs)
+		return blockFs, err
+	}
+
+	if len(record) < blockRecordHeaderLen || record[8] != ' ' || record[17] != ' ' {
+		return blockFs, fmt.Errorf("invalid record header")
+	}
+
+	length, err := strconv.ParseUint(string(record[0:8]), 16, 32)
+	if err != nil {
+		return blockFs, fmt.Errorf("invalid record length: %w", err)
+	}
+
+	checksum, err := strconv.ParseUint(string(record[9:17]), 16, 32)
+	if err != nil {
+		return blockFs, fmt.Errorf("invalid record checksum: %w", err)
+	}
+
+	blockFsJson := record[blockRecordHeaderLen:]
+	if uint64(len(blockFsJson)) != length {
+		return blockFs, fmt.Errorf("record length is %d, expected %d", len(blockFsJson), length)
+	}
+
+	if uint64(crc32.ChecksumIEEE(blockFsJson)) != checksum {
+		return blockFs, fmt.Errorf("record checksum mismatch")
+	}
+
+	err = json.Unmarshal(blockFsJson, &blockFs)
+
+	return blockFs, err
+}
+
+func (m fileIndexMeta) encode() []byte {
+	b := make([]byte, 0, 56)
+	b = append(b, encodeUint64(m.Count)...)
+	b = append(b, encodeUint64(uint64(m.Size))...)
+	b = append(b, encodeUint64(uint64(m.TipOffset))...)
+
+	return append(b, m.TipHash[:]...)
+}
+
+func (m *fileIndexMeta) decode(b []byte) error {
+	if len(b) != 56 {
+		return fmt.Errorf("invalid index meta length %d", len(b))
+	}
+
+	m.Count = binary.BigEndian.Uint64(b[0:8])
+	m.Size = int64(binary.BigEndian.Uint64(b[8:16]))
+	m.TipOffset = int64(binary.BigEndian.Uint64(b[16:24]))
+	copy(m.TipHash[:], b[24:])
+
+	return nil
+}
+
+func fileIndexHeightKey(height uint64) []byte {
+	return append(append([]byte{}, fileIndexHeightPrefix...), encodeUint64(height)...)
+}
+
+func fileIndexHashKey(hash Hash) []byte {
+	return append(append([]byte{}, fileIndexHashPrefix...), hash[:]...)
+}
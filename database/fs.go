@@ -1,13 +1,30 @@
 package database
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 )
 
+var ErrDataDirNotInitialized = errors.New("data dir is not initialized, run 'gc init' first")
+
+// InitDataDir validates the genesis and creates the data dir database with an empty chain.
+func InitDataDir(dataDir string, genesis []byte) error {
+	if isDataDirInitialized(dataDir) {
+		return fmt.Errorf("data dir '%s' is already initialized", dataDir)
+	}
+
+	if _, err := ParseGenesis(genesis); err != nil {
+		return err
+	}
+
+	return InitDataDirIfNotExists(dataDir, genesis)
+}
+
 func InitDataDirIfNotExists(dataDir string, genesis []byte) error {
-	if fileExists(getGenesisJsonFilePath(dataDir)) {
+	if isDataDirInitialized(dataDir) {
 		return nil
 	}
 
@@ -26,6 +43,19 @@ func InitDataDirIfNotExists(dataDir string, genesis []byte) error {
 	return nil
 }
 
+func isDataDirInitialized(dataDir string) bool {
+	return fileExists(getGenesisJsonFilePath(dataDir))
+}
+
+// checkDataDirInitialized fails with ErrDataDirNotInitialized rather than creating a missing data dir.
+func checkDataDirInitialized(dataDir string) error {
+	if !isDataDirInitialized(dataDir) {
+		return fmt.Errorf("'%s': %w", dataDir, ErrDataDirNotInitialized)
+	}
+
+	return nil
+}
+
 func getDatabaseDirPath(dataDir string) string {
 	return filepath.Join(dataDir, "database")
 }
@@ -34,10 +64,26 @@ func getGenesisJsonFilePath(dataDir string) string {
 	return filepath.Join(getDatabaseDirPath(dataDir), "genesis.json")
 }
 
+func getGenesisHashFilePath(dataDir string) string {
+	return filepath.Join(getDatabaseDirPath(dataDir), "genesis.hash")
+}
+
+func getReorgJournalFilePath(dataDir string) string {
+	return filepath.Join(getDatabaseDirPath(dataDir), "reorg.json")
+}
+
 func getBlocksDbFilePath(dataDir string) string {
 	return filepath.Join(getDatabaseDirPath(dataDir), "block.db")
 }
 
+func getBlocksLevelDBDirPath(dataDir string) string {
+	return filepath.Join(getDatabaseDirPath(dataDir), "blocks")
+}
+
+func getBlocksIndexDirPath(dataDir string) string {
+	return filepath.Join(getDatabaseDirPath(dataDir), "index")
+}
+
 func fileExists(filePath string) bool {
 	_, err := os.Stat(filePath)
 	if err != nil && os.IsNotExist(err) {
@@ -46,6 +92,14 @@ func fileExists(filePath string) bool {
 	return true
 }
 
+func isEmptyFile(filePath string) bool {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return true
+	}
+	return info.Size() == 0
+}
+
 func writeEmptyBlocksDbToDisk(path string) error {
 	return ioutil.WriteFile(path, []byte(""), os.ModePerm)
 }
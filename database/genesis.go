@@ -1,8 +1,13 @@
 package database
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -17,11 +22,190 @@ var genesisJson = `
    }
  }`
 
+// maxMiningDifficulty keeps at least one hash byte the miners can search through.
+const maxMiningDifficulty = 31
+
 type Genesis struct {
-	Balances map[common.Address]uint `json:"balances"`
-	Symbol   string                  `json:"symbol"`
+	Time      string                  `json:"genesis_time"`
+	ChainName string                  `json:"chain_name,omitempty"`
+	ChainID   uint64                  `json:"chain_id,omitempty"`
+	CoinName  string                  `json:"coin_name"`
+	Balances  map[common.Address]uint `json:"balances"`
+	Symbol    string                  `json:"symbol"`
+
+	// BlockReward paid to the miner of every block, the default BlockReward if not set
+	BlockReward uint `json:"block_reward,omitempty"`
+
+	// HalvingInterval halves the block reward every that many blocks, never if not set
+	HalvingInterval uint64 `json:"halving_interval,omitempty"`
+
+	// TailEmission is the lowest block reward the halvings go down to
+	TailEmission uint `json:"tail_emission,omitempty"`
+
+	// MaxSupply caps the premined balances and all the minted block rewards, unlimited if not set
+	MaxSupply uint `json:"max_supply,omitempty"`
+
+	// CoinbaseMaturity locks the block rewards and fees until that many blocks later, spendable by the next block if not set
+	CoinbaseMaturity uint64 `json:"coinbase_maturity,omitempty"`
+
+	// BlockGasLimit and MaxBlockSize, in bytes, limit the blocks since TIP10 fork, DefaultBlockGasLimit
+	// and DefaultMaxBlockSize if not set
+	BlockGasLimit uint `json:"block_gas_limit,omitempty"`
+	MaxBlockSize  uint `json:"max_block_size,omitempty"`
+
+	// Difficulty of the mined blocks, the node's default difficulty if not set.
+	// Since TIP5 fork it's only the initial difficulty, retargeted every DifficultyRetargetInterval blocks,
+	// and it's required by TIP5 and TIP6 forks.
+	Difficulty uint `json:"difficulty,omitempty"`
+
+	// TargetBlockTime is the intended time between two blocks, in seconds, required by TIP5 and TIP6 forks
+	TargetBlockTime uint64 `json:"target_block_time,omitempty"`
 
 	ForkTIP1 uint64 `json:"fork_tip_1"`
+
+	// ForkTIP2 commits the TXs Merkle root in every block header. Unlike TIP1, it's inactive unless scheduled.
+	ForkTIP2 *uint64 `json:"fork_tip_2,omitempty"`
+
+	// ForkTIP3 commits the root of the account balances and nonces tree in every block header.
+	ForkTIP3 *uint64 `json:"fork_tip_3,omitempty"`
+
+	// ForkTIP4 requires every TX to be signed for the ChainID, which must be set.
+	ForkTIP4 *uint64 `json:"fork_tip_4,omitempty"`
+
+	// Forks schedules the registered forks by name, e.g. "tip2", and height, see ChainConfig.
+	Forks map[string]uint64 `json:"forks,omitempty"`
+}
+
+// ParseGenesis strictly decodes and validates a genesis file content, rejecting unknown fields.
+func ParseGenesis(content []byte) (Genesis, error) {
+	var gen Genesis
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&gen); err != nil {
+		return Genesis{}, fmt.Errorf("invalid genesis: %w", err)
+	}
+
+	if err := gen.Validate(); err != nil {
+		return Genesis{}, fmt.Errorf("invalid genesis: %w", err)
+	}
+
+	return gen, nil
+}
+
+// Validate checks the genesis describes a chain the State can run.
+func (g Genesis) Validate() error {
+	if g.Time != "" {
+		if _, err := time.Parse(time.RFC3339, g.Time); err != nil {
+			return fmt.Errorf("genesis_time must be an RFC 3339 time: %w", err)
+		}
+	}
+
+	if g.ChainName != strings.TrimSpace(g.ChainName) {
+		return fmt.Errorf("chain_name '%s' can't start or end with spaces", g.ChainName)
+	}
+
+	if len(g.Balances) == 0 {
+		return fmt.Errorf("balances must premine at least one account")
+	}
+
+	supply := uint(0)
+	for account, balance := range g.Balances {
+		if account == (common.Address{}) {
+			return fmt.Errorf("balances can't premine the zero address")
+		}
+
+		if supply+balance < supply {
+			return fmt.Errorf("premined balances overflow")
+		}
+		supply += balance
+	}
+
+	config, err := g.ChainConfig()
+	if err != nil {
+		return err
+	}
+
+	if g.TailEmission > config.BlockReward {
+		return fmt.Errorf("tail_emission %d can't exceed the block reward %d", g.TailEmission, config.BlockReward)
+	}
+
+	if g.MaxSupply != 0 {
+		if g.TailEmission != 0 {
+			return fmt.Errorf("tail_emission keeps minting forever, it can't be combined with max_supply")
+		}
+
+		if g.MaxSupply < supply {
+			return fmt.Errorf("max_supply %d is lower than the premined balances %d", g.MaxSupply, supply)
+		}
+	}
+
+	if tip4 := config.ForkHeight(ForkTIP4); tip4 != nil {
+		if g.ChainID == 0 {
+			return fmt.Errorf("chain_id is required by fork %s", ForkTIP4)
+		}
+
+		// Only TIP1 TXs encode the chain ID into their signed payload
+		if *tip4 < *config.ForkHeight(ForkTIP1) {
+			return fmt.Errorf("fork %s can't activate before fork %s", ForkTIP4, ForkTIP1)
+		}
+	}
+
+	// The block order is committed by the TXs Merkle root, it can't be sorted away
+	if tip8 := config.ForkHeight(ForkTIP8); tip8 != nil {
+		if tip2 := config.ForkHeight(ForkTIP2); tip2 == nil || *tip8 < *tip2 {
+			return fmt.Errorf("fork %s can't activate before fork %s", ForkTIP8, ForkTIP2)
+		}
+	}
+
+	if tip11 := config.ForkHeight(ForkTIP11); tip11 != nil {
+		// The gas target the base fee moves around is derived from the block gas limit
+		for _, fork := range []string{ForkTIP1, ForkTIP10} {
+			if height := config.ForkHeight(fork); height == nil || *tip11 < *height {
+				return fmt.Errorf("fork %s can't activate before fork %s", ForkTIP11, fork)
+			}
+		}
+	}
+
+	// Only the first block has the genesis as parent, a later activation would never apply
+	if tip12 := config.ForkHeight(ForkTIP12); tip12 != nil && *tip12 != 0 {
+		return fmt.Errorf("fork %s must activate at the first block, not at %d", ForkTIP12, *tip12)
+	}
+
+	for _, fork := range []string{ForkTIP5, ForkTIP6} {
+		if config.ForkHeight(fork) == nil {
+			continue
+		}
+
+		if g.TargetBlockTime == 0 {
+			return fmt.Errorf("target_block_time is required by fork %s", fork)
+		}
+
+		// The retargeting must start from the same difficulty on every node, whatever their --difficulty
+		if g.Difficulty == 0 {
+			return fmt.Errorf("difficulty is required by fork %s", fork)
+		}
+	}
+
+	if g.BlockGasLimit != 0 && g.BlockGasLimit < TxGas {
+		return fmt.Errorf("block_gas_limit %d can't fit a single TX using %d gas", g.BlockGasLimit, TxGas)
+	}
+
+	if g.MaxBlockSize != 0 && g.MaxBlockSize < minMaxBlockSize {
+		return fmt.Errorf("max_block_size must be at least %d bytes, not %d", minMaxBlockSize, g.MaxBlockSize)
+	}
+
+	if g.Difficulty > maxMiningDifficulty {
+		return fmt.Errorf("difficulty must be at most %d, not %d", maxMiningDifficulty, g.Difficulty)
+	}
+
+	return nil
+}
+
+// DefaultGenesisJson returns the genesis of the GoCoin chain, a data dir is initialized with by default.
+func DefaultGenesisJson() []byte {
+	return []byte(genesisJson)
 }
 
 func loadGenesis(path string) (Genesis, error) {
@@ -36,9 +220,109 @@ func loadGenesis(path string) (Genesis, error) {
 		return Genesis{}, err
 	}
 
+	if err := loadedGenesis.Validate(); err != nil {
+		return Genesis{}, fmt.Errorf("invalid genesis: %w", err)
+	}
+
 	return loadedGenesis, nil
 }
 
+// Block returns the genesis block, the virtual parent of the first mined block, whose hash identifies the chain.
+//
+// Its header commits the genesis time, the root of the premined balances tree in the StateRoot and the SHA-256
+// of the other chain parameters in place of the TXs root: the canonical genesis JSON without the balances,
+// its fields in the declaration order, regardless of how the genesis.json file is formatted. The genesis block
+// is never stored nor mined. Since TIP12 fork the first mined block's parent is its hash, before it's empty.
+func (g Genesis) Block() (Block, error) {
+	genesisTime := uint64(0)
+	if g.Time != "" {
+		t, err := time.Parse(time.RFC3339, g.Time)
+		if err != nil {
+			return Block{}, fmt.Errorf("genesis_time must be an RFC 3339 time: %w", err)
+		}
+		genesisTime = uint64(t.Unix())
+	}
+
+	premine := State{Balances: g.Balances, Account2Nonce: make(map[common.Address]uint)}
+	stateRoot := premine.StateRoot()
+
+	params := g
+	params.Balances = nil
+
+	paramsJson, err := json.Marshal(params)
+	if err != nil {
+		return Block{}, err
+	}
+	paramsRoot := Hash(sha256.Sum256(paramsJson))
+
+	return Block{
+		Header: BlockHeader{
+			Parent:    Hash{},
+			Number:    0,
+			Time:      genesisTime,
+			TxRoot:    &paramsRoot,
+			StateRoot: &stateRoot,
+		},
+	}, nil
+}
+
+// Hash identifies the chain, it's the hash of the genesis Block header.
+//
+// Nodes only sync with peers of the same genesis hash.
+func (g Genesis) Hash() (Hash, error) {
+	b, err := g.Block()
+	if err != nil {
+		return Hash{}, err
+	}
+
+	return b.Hash()
+}
+
+// DataDirGenesisHash returns the genesis hash of an initialized data dir, verifying its genesis didn't change.
+func DataDirGenesisHash(dataDir string) (Hash, error) {
+	if err := checkDataDirInitialized(dataDir); err != nil {
+		return Hash{}, err
+	}
+
+	gen, err := loadGenesis(getGenesisJsonFilePath(dataDir))
+	if err != nil {
+		return Hash{}, err
+	}
+
+	return verifyGenesisHash(dataDir, gen)
+}
+
+// verifyGenesisHash checks the genesis didn't change since the data dir was first opened,
+// persisting its hash on the first call.
+func verifyGenesisHash(dataDir string, gen Genesis) (Hash, error) {
+	hash, err := gen.Hash()
+	if err != nil {
+		return Hash{}, err
+	}
+
+	path := getGenesisHashFilePath(dataDir)
+
+	if !fileExists(path) {
+		return hash, ioutil.WriteFile(path, []byte(hash.Hex()+"\n"), 0644)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	var persisted Hash
+	if err := persisted.UnmarshalText(bytes.TrimSpace(content)); err != nil {
+		return Hash{}, fmt.Errorf("invalid persisted genesis hash: %w", err)
+	}
+
+	if persisted != hash {
+		return Hash{}, fmt.Errorf("genesis.json hash is '%x' but the data dir was created with genesis '%x'", hash, persisted)
+	}
+
+	return hash, nil
+}
+
 func writeGenesisToDisk(path string, genesis []byte) error {
 	return ioutil.WriteFile(path, genesis, 0644)
 }
@@ -0,0 +1,250 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestGenesis_Hash(t *testing.T) {
+	a := NewAccount("0x00000000000000000000000000000000000000aa")
+	b := NewAccount("0x00000000000000000000000000000000000000bb")
+
+	var first, second Genesis
+
+	err := json.Unmarshal([]byte(`{"symbol":"GC","balances":{"`+a.Hex()+`":1,"`+b.Hex()+`":2}}`), &first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = json.Unmarshal([]byte(`{
+		"balances": {"`+b.Hex()+`": 2, "`+a.Hex()+`": 1},
+		"symbol": "GC"
+	}`), &second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firstHash, err := first.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secondHash, err := second.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if firstHash != secondHash {
+		t.Fatalf("genesis hash must not depend on the JSON formatting, got '%x' and '%x'", firstHash, secondHash)
+	}
+
+	block, err := first.Block()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if blockHash, _ := block.Hash(); blockHash != firstHash {
+		t.Fatalf("genesis hash must be the genesis block hash '%x', got '%x'", blockHash, firstHash)
+	}
+
+	premine := State{Balances: first.Balances}
+	if !block.Header.Parent.IsEmpty() || block.Header.StateRoot == nil || *block.Header.StateRoot != premine.StateRoot() {
+		t.Fatalf("genesis block must have no parent and commit the premined State root, got %+v", block.Header)
+	}
+
+	second.Balances[b] = 3
+
+	if secondHash, _ = second.Hash(); firstHash == secondHash {
+		t.Fatalf("genesis hash must commit the balances")
+	}
+
+	second.Balances[b] = 2
+	second.ChainID = 7
+
+	if secondHash, _ = second.Hash(); firstHash == secondHash {
+		t.Fatalf("genesis hash must commit the chain parameters")
+	}
+}
+
+func TestState_GenesisHashPersisted(t *testing.T) {
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+
+	dataDir := setupTestDataDir(t, map[common.Address]uint{miner: 1000})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := Genesis{Balances: map[common.Address]uint{miner: 1000}}.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.GenesisHash() != expected {
+		t.Fatalf("genesis hash must be '%x', got '%x'", expected, state.GenesisHash())
+	}
+
+	if err := state.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing the genesis of an existing data dir would silently fork it off its chain
+	genesisJson, err := json.Marshal(Genesis{Balances: map[common.Address]uint{miner: 2000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(getGenesisJsonFilePath(dataDir), genesisJson, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil); err == nil {
+		t.Fatalf("data dir with a changed genesis must not be opened")
+	}
+
+	if _, err := VerifyChain(dataDir, testMiningDifficulty); err == nil {
+		t.Fatalf("data dir with a changed genesis must not be verified")
+	}
+}
+
+func TestState_FirstBlockParentFork(t *testing.T) {
+	minerA := NewAccount("0x00000000000000000000000000000000000000aa")
+	minerB := NewAccount("0x00000000000000000000000000000000000000bb")
+
+	gen := Genesis{Balances: map[common.Address]uint{minerA: 1000}, Forks: map[string]uint64{ForkTIP12: 0}}
+
+	dataDir := setupTestDataDirWithGenesis(t, gen)
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genesisHash, err := gen.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.NextBlockParent() != genesisHash {
+		t.Fatalf("first block parent must be the genesis hash '%x', got '%x'", genesisHash, state.NextBlockParent())
+	}
+
+	if _, _, err := state.ImportBlock(mineTestBlock(t, Hash{}, 0, minerA, nil)); err == nil {
+		t.Fatalf("first block with an empty parent must be rejected since %s fork", ForkTIP12)
+	}
+
+	addTestBlock(t, state, mineTestBlock(t, genesisHash, 0, minerA, nil))
+
+	// A heavier branch forking off the genesis replaces the whole main chain
+	b0 := mineTestBlock(t, genesisHash, 0, minerB, nil)
+	b0Hash := addTestBlock(t, state, b0)
+	b1Hash, reorg, err := state.ImportBlock(mineTestBlock(t, b0Hash, 1, minerB, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reorg == nil || reorg.CommonAncestor != genesisHash || len(reorg.Detached) != 1 || reorg.Detached[0].Header.Miner != minerA {
+		t.Fatalf("branch forking off the genesis must replace the first block, got %+v", reorg)
+	}
+
+	if state.LatestBlockHash() != b1Hash {
+		t.Fatalf("latest block must be '%x', got '%x'", b1Hash, state.LatestBlockHash())
+	}
+
+	if err := state.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := VerifyChain(dataDir, testMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Blocks != 2 || report.TipHash != b1Hash {
+		t.Fatalf("expected 2 verified blocks up to '%x', got %d up to '%x'", b1Hash, report.Blocks, report.TipHash)
+	}
+}
+
+func TestInitDataDir(t *testing.T) {
+	dataDir, err := ioutil.TempDir("/tmp", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	if _, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil); !errors.Is(err, ErrDataDirNotInitialized) {
+		t.Fatalf("uninitialized data dir must not be opened, got %v", err)
+	}
+
+	if isDataDirInitialized(dataDir) {
+		t.Fatalf("opening an uninitialized data dir must not initialize it")
+	}
+
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+
+	invalid := []string{
+		`{"balances":{}}`,
+		`{"balances":{"0x0000000000000000000000000000000000000000":10}}`,
+		`{"balances":{"` + miner.Hex() + `":10},"difficulty":32}`,
+		`{"balances":{"` + miner.Hex() + `":10},"genesis_time":"yesterday"}`,
+		`{"balances":{"` + miner.Hex() + `":10},"block_rewards":5}`,
+		`{"balances":{"` + miner.Hex() + `":10},"fork_tip_4":10}`,
+		`{"balances":{"` + miner.Hex() + `":10},"max_supply":5}`,
+		`{"balances":{"` + miner.Hex() + `":10},"max_supply":50,"tail_emission":1}`,
+		`{"balances":{"` + miner.Hex() + `":10},"tail_emission":200}`,
+		`{"balances":{"` + miner.Hex() + `":10},"block_gas_limit":20}`,
+		`{"balances":{"` + miner.Hex() + `":10},"max_block_size":100}`,
+		`{"balances":{"` + miner.Hex() + `":10},"forks":{"tip11":0}}`,
+		`{"balances":{"` + miner.Hex() + `":10},"forks":{"tip8":0}}`,
+		`{"balances":{"` + miner.Hex() + `":10},"target_block_time":15,"forks":{"tip5":0}}`,
+		`{"balances":{"` + miner.Hex() + `":10},"forks":{"tip2":5,"tip8":4}}`,
+		`{"balances":{"` + miner.Hex() + `":10},"forks":{"tip12":1}}`,
+	}
+
+	for _, genesis := range invalid {
+		if err := InitDataDir(dataDir, []byte(genesis)); err == nil {
+			t.Errorf("genesis %s must be rejected", genesis)
+		}
+	}
+
+	genesis := `{
+		"chain_name": "testnet",
+		"chain_id": 7,
+		"balances": {"` + miner.Hex() + `": 10},
+		"block_reward": 25,
+		"difficulty": 1,
+		"target_block_time": 15
+	}`
+
+	if err := InitDataDir(dataDir, []byte(genesis)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := InitDataDir(dataDir, []byte(genesis)); err == nil {
+		t.Fatalf("initialized data dir must not be initialized again")
+	}
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty+1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	if state.MiningDifficulty() != 1 {
+		t.Fatalf("genesis difficulty must override the default, got %d", state.MiningDifficulty())
+	}
+
+	addTestBlock(t, state, mineTestBlock(t, Hash{}, 0, miner, nil))
+
+	if state.Balances[miner] != 35 {
+		t.Fatalf("miner must be paid the genesis block reward, balance is %d", state.Balances[miner])
+	}
+}
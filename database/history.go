@@ -0,0 +1,179 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const HistoryIn = "in"
+const HistoryOut = "out"
+const HistoryReward = "reward"
+
+// AddressTx is an entry of the address history: a transfer in or out of the address, or a mining reward.
+type AddressTx struct {
+	Account   common.Address `json:"account"`
+	Direction string         `json:"direction"`
+	BlockHash Hash           `json:"block_hash"`
+	Height    uint64         `json:"block_height"`
+
+	// Index is the TX position within the block, rewards come after the block TXs
+	Index  int  `json:"index"`
+	TxHash Hash `json:"tx_hash"`
+
+	// Counterparty is the other side of a transfer, empty for rewards
+	Counterparty common.Address `json:"counterparty"`
+	Value        uint           `json:"value"`
+	Fee          uint           `json:"fee"`
+	Time         uint64         `json:"time"`
+}
+
+// AddressHistoryFilter selects the address history entries, from the oldest.
+type AddressHistoryFilter struct {
+	// Direction is one of HistoryIn, HistoryOut, HistoryReward or empty for all of them
+	Direction string
+
+	FromHeight uint64
+
+	// ToHeight is inclusive, nil for the latest block
+	ToHeight *uint64
+
+	Offset int
+
+	// Limit of 0 returns all the entries
+	Limit int
+}
+
+type AddressHistory struct {
+	Txs   []AddressTx `json:"txs"`
+	Total int         `json:"total"`
+}
+
+// GetAddressHistory returns a page of the address history matching the filter, with the total number of matches.
+func (s *State) GetAddressHistory(account common.Address, filter AddressHistoryFilter) (AddressHistory, error) {
+	history := AddressHistory{Txs: make([]AddressTx, 0)}
+
+	switch filter.Direction {
+	case "", HistoryIn, HistoryOut, HistoryReward:
+	default:
+		return history, fmt.Errorf("invalid direction '%s', must be one of: %s, %s, %s", filter.Direction, HistoryIn, HistoryOut, HistoryReward)
+	}
+
+	if s.txIndex == nil {
+		return history, fmt.Errorf("TX index is not open")
+	}
+
+	prefix := addressHistoryPrefix(account)
+	historyRange := util.BytesPrefix(prefix)
+	historyRange.Start = append(append([]byte{}, prefix...), encodeUint64(filter.FromHeight)...)
+
+	if filter.ToHeight != nil {
+		if *filter.ToHeight < filter.FromHeight {
+			return history, nil
+		}
+
+		if *filter.ToHeight < ^uint64(0) {
+			historyRange.Limit = append(append([]byte{}, prefix...), encodeUint64(*filter.ToHeight+1)...)
+		}
+	}
+
+	iter := s.txIndex.db.NewIterator(historyRange, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var entry AddressTx
+		if err := json.Unmarshal(iter.Value(), &entry); err != nil {
+			return history, err
+		}
+
+		if filter.Direction != "" && entry.Direction != filter.Direction {
+			continue
+		}
+
+		if history.Total >= filter.Offset && (filter.Limit == 0 || len(history.Txs) < filter.Limit) {
+			history.Txs = append(history.Txs, entry)
+		}
+		history.Total++
+	}
+
+	return history, iter.Error()
+}
+
+// addressTxs returns the history entries of all the addresses involved in the block.
+func addressTxs(hash Hash, b Block, rules Rules) ([]AddressTx, error) {
+	entries := make([]AddressTx, 0, 2*len(b.Txs)+1)
+
+	for i, tx := range b.Txs {
+		txHash, err := tx.Hash()
+		if err != nil {
+			return nil, err
+		}
+
+		if rules.IsTIP7 && tx.IsReward() {
+			entries = append(entries, AddressTx{
+				Account:   tx.To,
+				Direction: HistoryReward,
+				BlockHash: hash,
+				Height:    b.Header.Number,
+				Index:     i,
+				TxHash:    txHash,
+				Value:     tx.Value,
+				Time:      tx.Time,
+			})
+			continue
+		}
+
+		out := AddressTx{
+			Account:      tx.From,
+			Direction:    HistoryOut,
+			BlockHash:    hash,
+			Height:       b.Header.Number,
+			Index:        i,
+			TxHash:       txHash,
+			Counterparty: tx.To,
+			Value:        tx.Value,
+			Fee:          txCost(tx, rules) - tx.Value,
+			Time:         tx.Time,
+		}
+
+		in := out
+		in.Account = tx.To
+		in.Direction = HistoryIn
+		in.Counterparty = tx.From
+		in.Fee = 0
+
+		entries = append(entries, out, in)
+	}
+
+	// Since TIP7 fork the reward TXs record the minted coins
+	if rules.IsTIP7 {
+		return entries, nil
+	}
+
+	entries = append(entries, AddressTx{
+		Account:   b.Header.Miner,
+		Direction: HistoryReward,
+		BlockHash: hash,
+		Height:    b.Header.Number,
+		Index:     len(b.Txs),
+		Value:     minerReward(b, rules),
+		Time:      b.Header.Time,
+	})
+
+	return entries, nil
+}
+
+// key orders the address entries by height and position within the block.
+func (e AddressTx) key() []byte {
+	key := addressHistoryPrefix(e.Account)
+	key = append(key, encodeUint64(e.Height)...)
+	key = append(key, encodeUint64(uint64(e.Index))...)
+
+	return append(key, e.Direction...)
+}
+
+func addressHistoryPrefix(account common.Address) []byte {
+	return append(append([]byte{}, txIndexAddressPrefix...), account.Bytes()...)
+}
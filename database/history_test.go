@@ -0,0 +1,105 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestState_AddressHistory(t *testing.T) {
+	senderKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(senderKey.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	minerA := NewAccount("0x00000000000000000000000000000000000000aa")
+	minerB := NewAccount("0x00000000000000000000000000000000000000bb")
+
+	dataDir := setupTestDataDir(t, map[common.Address]uint{sender: 1000})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	tx0 := signTestTx(t, NewBaseTx(sender, receiver, 10, 1, ""), senderKey)
+	tx1 := signTestTx(t, NewBaseTx(sender, receiver, 20, 2, ""), senderKey)
+	txBranch := signTestTx(t, NewBaseTx(sender, minerB, 30, 2, "branch"), senderKey)
+
+	a0Hash := addTestBlock(t, state, mineTestBlock(t, Hash{}, 0, minerA, []SignedTx{tx0}))
+	addTestBlock(t, state, mineTestBlock(t, a0Hash, 1, minerA, []SignedTx{tx1}))
+
+	history, err := state.GetAddressHistory(sender, AddressHistoryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if history.Total != 2 || history.Txs[0].Direction != HistoryOut || history.Txs[0].Height != 0 || history.Txs[1].Height != 1 {
+		t.Fatalf("sender must have 2 outgoing TXs ordered by height, got %+v", history)
+	}
+
+	if history.Txs[0].Counterparty != receiver || history.Txs[0].Value != 10 || history.Txs[0].Fee != tx0.GasCost() {
+		t.Errorf("unexpected outgoing TX entry %+v", history.Txs[0])
+	}
+
+	history, err = state.GetAddressHistory(receiver, AddressHistoryFilter{Direction: HistoryIn, FromHeight: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if history.Total != 1 || history.Txs[0].Value != 20 || history.Txs[0].Counterparty != sender || history.Txs[0].Fee != 0 {
+		t.Fatalf("receiver must have 1 incoming TX from height 1, got %+v", history)
+	}
+
+	toHeight := uint64(0)
+	history, err = state.GetAddressHistory(minerA, AddressHistoryFilter{Direction: HistoryReward, ToHeight: &toHeight})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if history.Total != 1 || history.Txs[0].Value != BlockReward+tx0.GasCost() || !history.Txs[0].TxHash.IsEmpty() {
+		t.Fatalf("miner must have 1 reward up to height 0, got %+v", history)
+	}
+
+	history, err = state.GetAddressHistory(minerA, AddressHistoryFilter{Offset: 1, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if history.Total != 2 || len(history.Txs) != 1 || history.Txs[0].Height != 1 {
+		t.Fatalf("second page must hold the reward of block 1 out of 2, got %+v", history)
+	}
+
+	if _, err := state.GetAddressHistory(sender, AddressHistoryFilter{Direction: "sideways"}); err == nil {
+		t.Fatalf("invalid direction must be rejected")
+	}
+
+	// Reorg onto a heavier branch replacing block 1
+	b1Hash := addTestBlock(t, state, mineTestBlock(t, a0Hash, 1, minerB, []SignedTx{txBranch}))
+	if _, _, err := state.ImportBlock(mineTestBlock(t, b1Hash, 2, minerB, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err = state.GetAddressHistory(receiver, AddressHistoryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if history.Total != 1 || history.Txs[0].Height != 0 {
+		t.Fatalf("receiver TX of the detached block must be removed from its history, got %+v", history)
+	}
+
+	history, err = state.GetAddressHistory(minerB, AddressHistoryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if history.Total != 3 || history.Txs[0].Direction != HistoryIn || history.Txs[1].Direction != HistoryReward || history.Txs[2].Height != 2 {
+		t.Fatalf("miner B must have the branch TX and 2 rewards, got %+v", history)
+	}
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var levelDBHeightPrefix = []byte("n")
+var levelDBHashPrefix = []byte("h")
+
+// syncWrite makes a write durable before it's reported as successful.
+var syncWrite = &opt.WriteOptions{Sync: true}
+
+// LevelDBBlockStore keeps the blocks in an embedded key-value database.
+//
+// Blocks are stored by their height, with a secondary hash -> height key.
+type LevelDBBlockStore struct {
+	db *leveldb.DB
+}
+
+func NewLevelDBBlockStore(dataDir string) (*LevelDBBlockStore, error) {
+	if !fileExists(getBlocksLevelDBDirPath(dataDir)) && !isEmptyFile(getBlocksDbFilePath(dataDir)) {
+		return nil, fmt.Errorf("data dir '%s' uses the '%s' db engine", dataDir, FileDBEngine)
+	}
+
+	db, err := leveldb.OpenFile(getBlocksLevelDBDirPath(dataDir), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LevelDBBlockStore{db: db}, nil
+}
+
+func (ls *LevelDBBlockStore) Append(hash Hash, b Block) error {
+	blockFsJson, err := json.Marshal(BlockFS{Key: hash, Value: b})
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Put(levelDBHeightKey(b.Header.Number), blockFsJson)
+	batch.Put(levelDBHashKey(hash), encodeUint64(b.Header.Number))
+
+	return ls.db.Write(batch, syncWrite)
+}
+
+func (ls *LevelDBBlockStore) BlockByHash(hash Hash) (BlockFS, error) {
+	height, err := ls.db.Get(levelDBHashKey(hash), nil)
+	if err == leveldb.ErrNotFound {
+		return BlockFS{}, ErrBlockNotFound
+	}
+	if err != nil {
+		return BlockFS{}, err
+	}
+
+	return ls.BlockByHeight(binary.BigEndian.Uint64(height))
+}
+
+func (ls *LevelDBBlockStore) BlockByHeight(height uint64) (BlockFS, error) {
+	var blockFs BlockFS
+
+	blockFsJson, err := ls.db.Get(levelDBHeightKey(height), nil)
+	if err == leveldb.ErrNotFound {
+		return blockFs, ErrBlockNotFound
+	}
+	if err != nil {
+		return blockFs, err
+	}
+
+	err = json.Unmarshal(blockFsJson, &blockFs)
+	if err != nil {
+		return blockFs, err
+	}
+
+	return blockFs, nil
+}
+
+func (ls *LevelDBBlockStore) Iterate(fromHeight uint64, fn func(BlockFS) error) error {
+	iter := ls.db.NewIterator(&util.Range{
+		Start: levelDBHeightKey(fromHeight),
+		Limit: util.BytesPrefix(levelDBHeightPrefix).Limit,
+	}, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var blockFs BlockFS
+
+		if err := json.Unmarshal(iter.Value(), &blockFs); err != nil {
+			return err
+		}
+
+		if err := fn(blockFs); err != nil {
+			return err
+		}
+	}
+
+	return iter.Error()
+}
+
+func (ls *LevelDBBlockStore) Truncate(fromHeight uint64) error {
+	batch := new(leveldb.Batch)
+
+	err := ls.Iterate(fromHeight, func(blockFs BlockFS) error {
+		batch.Delete(levelDBHeightKey(blockFs.Value.Header.Number))
+		batch.Delete(levelDBHashKey(blockFs.Key))
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return ls.db.Write(batch, syncWrite)
+}
+
+func (ls *LevelDBBlockStore) Close() error {
+	return ls.db.Close()
+}
+
+func levelDBHeightKey(height uint64) []byte {
+	return append(append([]byte{}, levelDBHeightPrefix...), encodeUint64(height)...)
+}
+
+func levelDBHashKey(hash Hash) []byte {
+	return append(append([]byte{}, levelDBHashPrefix...), hash[:]...)
+}
+
+func encodeUint64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+
+	return b
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ImmatureReward is a block reward, with the fees, credited to an account but locked until the CoinbaseMaturity.
+type ImmatureReward struct {
+	Number  uint64         `json:"block_number"`
+	Account common.Address `json:"account"`
+	Value   uint           `json:"value"`
+}
+
+// MaturityHeight returns the height of the first block able to spend the rewards of the block at the given height.
+func (c ChainConfig) MaturityHeight(number uint64) uint64 {
+	if c.CoinbaseMaturity == 0 {
+		return number + 1
+	}
+
+	return number + c.CoinbaseMaturity
+}
+
+// ImmatureBalance returns the part of the account balance the next block can't spend yet.
+func (s *State) ImmatureBalance(account common.Address) uint {
+	immature := uint(0)
+
+	for _, reward := range s.immature {
+		if reward.Account == account {
+			immature += reward.Value
+		}
+	}
+
+	return immature
+}
+
+// SpendableBalance returns the account balance the next block can spend, without its immature rewards.
+func (s *State) SpendableBalance(account common.Address) uint {
+	return s.Balances[account] - s.ImmatureBalance(account)
+}
+
+// ImmatureBalances returns the immature balance of every account with locked rewards.
+func (s *State) ImmatureBalances() map[common.Address]uint {
+	balances := make(map[common.Address]uint)
+
+	for _, reward := range s.immature {
+		balances[reward.Account] += reward.Value
+	}
+
+	return balances
+}
+
+// lockRewards returns the rewards still immature for the next block number, with the rewards of the new block
+// appended. The given slice is shared by State copies, so it's never modified.
+func lockRewards(immature []ImmatureReward, rewards []ImmatureReward, config ChainConfig, nextNumber uint64) []ImmatureReward {
+	locked := make([]ImmatureReward, 0, len(immature)+len(rewards))
+
+	for _, reward := range immature {
+		if config.MaturityHeight(reward.Number) > nextNumber {
+			locked = append(locked, reward)
+		}
+	}
+
+	for _, reward := range rewards {
+		if config.MaturityHeight(reward.Number) > nextNumber {
+			locked = append(locked, reward)
+		}
+	}
+
+	return locked
+}
+
+func equalImmatureRewards(a, b []ImmatureReward) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
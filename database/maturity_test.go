@@ -0,0 +1,78 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestState_CoinbaseMaturity(t *testing.T) {
+	minerKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	miner := crypto.PubkeyToAddress(minerKey.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+
+	dataDir := setupTestDataDirWithGenesis(t, Genesis{
+		Balances:         map[common.Address]uint{receiver: 1000},
+		CoinbaseMaturity: 3,
+	})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	parent := addTestBlock(t, state, mineTestBlock(t, Hash{}, 0, miner, nil))
+
+	if state.Balances[miner] != BlockReward || state.ImmatureBalance(miner) != BlockReward || state.SpendableBalance(miner) != 0 {
+		t.Fatalf("block 0 reward must be immature, got balance %d, immature %d", state.Balances[miner], state.ImmatureBalance(miner))
+	}
+
+	tx := signTestTx(t, NewBaseTx(miner, receiver, 10, 1, ""), minerKey)
+	if err := ValidateTx(tx, state); err == nil {
+		t.Fatalf("TX spending an immature reward must be rejected")
+	}
+
+	if _, err := state.AddBlock(mineTestBlock(t, parent, 1, miner, []SignedTx{tx})); err == nil {
+		t.Fatalf("block spending an immature reward must be rejected")
+	}
+
+	for number := uint64(1); number < 3; number++ {
+		parent = addTestBlock(t, state, mineTestBlock(t, parent, number, miner, nil))
+	}
+
+	// Block 0 reward matured, the rewards of blocks 1 and 2 are still locked
+	if state.ImmatureBalance(miner) != 2*BlockReward || state.SpendableBalance(miner) != BlockReward {
+		t.Fatalf("only block 0 reward must be spendable, got immature %d", state.ImmatureBalance(miner))
+	}
+
+	if err := ValidateTx(tx, state); err != nil {
+		t.Fatalf("TX spending a mature reward must be valid, got: %s", err)
+	}
+
+	accounts, err := state.AccountsAt(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if accounts.Immature[miner] != 2*BlockReward || accounts.Spendable(miner) != 0 {
+		t.Fatalf("blocks 0 and 1 rewards must be immature after block 1, got %+v", accounts.Immature)
+	}
+
+	addTestBlock(t, state, mineTestBlock(t, parent, 3, miner, []SignedTx{tx}))
+
+	if state.Balances[receiver] != 1010 {
+		t.Fatalf("receiver must be paid from the mature reward, got %d", state.Balances[receiver])
+	}
+
+	// Block 1 reward matured, block 3 fees are locked together with its block reward
+	if state.ImmatureBalance(miner) != 2*BlockReward+tx.GasCost() {
+		t.Fatalf("miner immature balance must include block 3 fees, got %d", state.ImmatureBalance(miner))
+	}
+}
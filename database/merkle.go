@@ -0,0 +1,191 @@
+package database
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// TxInclusionProof proves a TX is committed in a block, verifiable with VerifyTxInclusion against the block header.
+type TxInclusionProof struct {
+	TxHash    Hash        `json:"tx_hash"`
+	BlockHash Hash        `json:"block_hash"`
+	Header    BlockHeader `json:"header"`
+	Index     int         `json:"index"`
+	TxCount   int         `json:"tx_count"`
+
+	// Path holds the sibling hashes from the TX up to the TXs Merkle root
+	Path []Hash `json:"path"`
+}
+
+// TxsMerkleRoot returns the root of a binary Merkle tree over the TX hashes, in the block order.
+//
+// Leaves and inner nodes are hashed with a 0x00 and 0x01 prefix, so an inner node can't be passed off as a TX.
+// A node without a sibling is moved up a level unchanged. The root of no TXs is the empty hash.
+func TxsMerkleRoot(txs []SignedTx) (Hash, error) {
+	level, err := txsMerkleLeaves(txs)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	if len(level) == 0 {
+		return Hash{}, nil
+	}
+
+	for len(level) > 1 {
+		level = nextMerkleLevel(level)
+	}
+
+	return level[0], nil
+}
+
+// TxMerkleProof returns the sibling hashes on the path from the TX at the index up to the TXs Merkle root.
+func TxMerkleProof(txs []SignedTx, index int) ([]Hash, error) {
+	level, err := txsMerkleLeaves(txs)
+	if err != nil {
+		return nil, err
+	}
+
+	if index < 0 || index >= len(level) {
+		return nil, fmt.Errorf("TX index %d is out of the %d block TXs", index, len(level))
+	}
+
+	path := make([]Hash, 0)
+
+	for len(level) > 1 {
+		if index%2 == 1 {
+			path = append(path, level[index-1])
+		} else if index+1 < len(level) {
+			path = append(path, level[index+1])
+		}
+
+		level = nextMerkleLevel(level)
+		index /= 2
+	}
+
+	return path, nil
+}
+
+// VerifyTxInclusion checks the path leads from the TX hash at the index, among the count of block TXs, to the TXs
+// Merkle root committed in the block header.
+//
+// The side of every sibling is worked out from the TX position in the tree, never trusted from the proof.
+func VerifyTxInclusion(txHash Hash, header BlockHeader, index int, count int, path []Hash) error {
+	if header.TxRoot == nil {
+		return fmt.Errorf("block %d doesn't commit a TXs Merkle root", header.Number)
+	}
+
+	if index < 0 || index >= count {
+		return fmt.Errorf("TX index %d is out of the %d block TXs", index, count)
+	}
+
+	node := hashMerkleLeaf(txHash)
+	siblings := path
+	for position, width := index, count; width > 1; position, width = position/2, (width+1)/2 {
+		if position%2 == 0 && position+1 == width {
+			// The node without a sibling is moved up a level unchanged
+			continue
+		}
+
+		if len(siblings) == 0 {
+			return fmt.Errorf("TX '%x' proof is too short for index %d of %d TXs", txHash, index, count)
+		}
+
+		if position%2 == 1 {
+			node = hashMerkleNode(siblings[0], node)
+		} else {
+			node = hashMerkleNode(node, siblings[0])
+		}
+		siblings = siblings[1:]
+	}
+
+	if len(siblings) != 0 {
+		return fmt.Errorf("TX '%x' proof is too long for index %d of %d TXs", txHash, index, count)
+	}
+
+	if node != *header.TxRoot {
+		return fmt.Errorf("TX '%x' is not included in block %d, proof leads to '%x' instead of '%x'", txHash, header.Number, node, *header.TxRoot)
+	}
+
+	return nil
+}
+
+// GetTxInclusionProof proves the inclusion of a main chain TX in its block.
+func GetTxInclusionProof(state *State, txHash Hash) (TxInclusionProof, error) {
+	proof := TxInclusionProof{TxHash: txHash}
+
+	_, location, err := state.GetTx(txHash)
+	if errors.Is(err, ErrTxNotFound) {
+		return proof, fmt.Errorf("TX '%x' is not part of the main chain", txHash)
+	}
+	if err != nil {
+		return proof, err
+	}
+
+	blockFs, err := state.store.BlockByHash(location.BlockHash)
+	if err != nil {
+		return proof, err
+	}
+
+	proof.BlockHash = blockFs.Key
+	proof.Header = blockFs.Value.Header
+	proof.Index = location.Index
+	proof.TxCount = len(blockFs.Value.Txs)
+
+	if proof.Header.TxRoot == nil {
+		return proof, fmt.Errorf("TX '%x' was mined in block %d before TIP2 fork, which doesn't commit its TXs", txHash, proof.Header.Number)
+	}
+
+	proof.Path, err = TxMerkleProof(blockFs.Value.Txs, proof.Index)
+	if err != nil {
+		return proof, err
+	}
+
+	return proof, nil
+}
+
+func txsMerkleLeaves(txs []SignedTx) ([]Hash, error) {
+	leaves := make([]Hash, len(txs))
+
+	for i, tx := range txs {
+		hash, err := tx.Hash()
+		if err != nil {
+			return nil, err
+		}
+		leaves[i] = hashMerkleLeaf(hash)
+	}
+
+	return leaves, nil
+}
+
+func nextMerkleLevel(level []Hash) []Hash {
+	next := make([]Hash, 0, (len(level)+1)/2)
+
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			next = append(next, level[i])
+			continue
+		}
+
+		next = append(next, hashMerkleNode(level[i], level[i+1]))
+	}
+
+	return next
+}
+
+func hashMerkleLeaf(txHash Hash) Hash {
+	data := make([]byte, 0, 1+len(txHash))
+	data = append(data, 0)
+	data = append(data, txHash[:]...)
+
+	return sha256.Sum256(data)
+}
+
+func hashMerkleNode(left, right Hash) Hash {
+	data := make([]byte, 0, 1+2*len(left))
+	data = append(data, 1)
+	data = append(data, left[:]...)
+	data = append(data, right[:]...)
+
+	return sha256.Sum256(data)
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestTxMerkleProof(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+
+	txs := make([]SignedTx, 0)
+	for i := uint(1); i <= 7; i++ {
+		txs = append(txs, signTestTx(t, NewBaseTx(sender, receiver, i, i, ""), key))
+
+		root, err := TxsMerkleRoot(txs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := BlockHeader{TxRoot: &root}
+
+		for index, tx := range txs {
+			txHash, err := tx.Hash()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path, err := TxMerkleProof(txs, index)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := VerifyTxInclusion(txHash, header, index, len(txs), path); err != nil {
+				t.Fatalf("TX %d of %d must be proven: %s", index, len(txs), err)
+			}
+
+			if len(txs) > 1 {
+				if err := VerifyTxInclusion(txHash, header, index^1, len(txs), path); err == nil {
+					t.Fatalf("proof of TX %d of %d at another index must be rejected", index, len(txs))
+				}
+
+				if err := VerifyTxInclusion(txHash, header, index, len(txs), path[1:]); err == nil {
+					t.Fatalf("truncated proof of TX %d of %d must be rejected", index, len(txs))
+				}
+			}
+		}
+	}
+
+	// The inner node over the first 2 TXs must not be proven as a TX of a 2 TXs tree
+	leaves, err := txsMerkleLeaves(txs[:4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := hashMerkleNode(leaves[0], leaves[1])
+	sibling := hashMerkleNode(leaves[2], leaves[3])
+	root := hashMerkleNode(inner, sibling)
+
+	if err := VerifyTxInclusion(inner, BlockHeader{TxRoot: &root}, 0, 2, []Hash{sibling}); err == nil {
+		t.Fatal("inner Merkle node must not be proven as a TX")
+	}
+}
+
+func TestState_TxRootFork(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+
+	forkTIP2 := uint64(1)
+	dataDir := setupTestDataDirWithGenesis(t, Genesis{Balances: map[common.Address]uint{sender: 1000}, ForkTIP2: &forkTIP2})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	b0 := mineTestBlock(t, Hash{}, 0, miner, nil)
+	b0.Header.TxRoot = &Hash{}
+	if _, err := state.AddBlock(b0); err == nil {
+		t.Fatal("block committing its TXs before TIP2 must be rejected")
+	}
+
+	b0Hash := addTestBlock(t, state, mineTestBlock(t, Hash{}, 0, miner, nil))
+
+	tx1 := signTestTx(t, NewBaseTx(sender, receiver, 10, 1, ""), key)
+	tx2 := signTestTx(t, NewBaseTx(sender, receiver, 20, 2, ""), key)
+	tx3 := signTestTx(t, NewBaseTx(sender, receiver, 30, 3, ""), key)
+
+	if _, err := state.AddBlock(mineTestBlock(t, b0Hash, 1, miner, []SignedTx{tx1, tx2, tx3})); err == nil {
+		t.Fatal("block without TXs Merkle root must be rejected since TIP2")
+	}
+
+	b1 := NewBlock(b0Hash, 1, 0, 1650000001, miner, []SignedTx{tx3, tx1, tx2})
+	if err := b1.CommitTxs(); err != nil {
+		t.Fatal(err)
+	}
+
+	b1Hash := addTestBlock(t, state, mineTestPreparedBlock(t, b1))
+
+	tx2Hash, err := tx2.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proof, err := GetTxInclusionProof(state, tx2Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if proof.BlockHash != b1Hash || proof.Index != 1 {
+		t.Fatalf("TX must be found in block '%x' at index 1, got '%x' at %d", b1Hash, proof.BlockHash, proof.Index)
+	}
+
+	headerHash, err := proof.Header.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if headerHash != b1Hash {
+		t.Fatal("block hash must be the hash of the header committing the TXs")
+	}
+
+	if proof.TxCount != 3 {
+		t.Fatalf("proof must be for a block of 3 TXs, got %d", proof.TxCount)
+	}
+
+	if err := VerifyTxInclusion(tx2Hash, proof.Header, proof.Index, proof.TxCount, proof.Path); err != nil {
+		t.Fatal(err)
+	}
+}
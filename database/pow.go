@@ -0,0 +1,125 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+)
+
+// Target is the 256-bit number a block hash must not exceed, big-endian like the Hash.
+type Target [32]byte
+
+// MaxTarget is the easiest target, the one of the lowest mining difficulty 1.
+var MaxTarget = DifficultyTarget(1)
+
+// twoTo256 is the number of all the possible hashes.
+var twoTo256 = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// DifficultyTarget returns the target of a mining difficulty, the number of leading zero bytes a hash needs.
+func DifficultyTarget(miningDifficulty uint) Target {
+	var t Target
+
+	for i := miningDifficulty; i < uint(len(t)); i++ {
+		t[i] = 0xff
+	}
+
+	return t
+}
+
+// MeetsTarget reports whether the hash doesn't exceed the target, without allocating.
+func (h Hash) MeetsTarget(t *Target) bool {
+	return bytes.Compare(h[:], t[:]) <= 0
+}
+
+// MeetsPoW reports whether the block hash meets the PoW of its target. Since TIP6 fork the hash mustn't exceed
+// the target. Before, the hash must start with exactly the zero bytes of the difficulty target, the byte after
+// them being non-zero, the way the blocks were always mined.
+func (h Hash) MeetsPoW(t *Target, isTIP6 bool) bool {
+	if !h.MeetsTarget(t) {
+		return false
+	}
+
+	if isTIP6 {
+		return true
+	}
+
+	for i := range t {
+		if t[i] != 0 {
+			return h[i] != 0
+		}
+	}
+
+	return true
+}
+
+func (t Target) Big() *big.Int {
+	return new(big.Int).SetBytes(t[:])
+}
+
+// Work returns the expected number of hashes required to find one meeting the target.
+func (t Target) Work() *big.Int {
+	return new(big.Int).Div(twoTo256, new(big.Int).Add(t.Big(), big.NewInt(1)))
+}
+
+// targetFromBig returns the target of the number, the MaxTarget if it's easier.
+func targetFromBig(v *big.Int) Target {
+	if v.Cmp(MaxTarget.Big()) > 0 {
+		return MaxTarget
+	}
+
+	var t Target
+	v.FillBytes(t[:])
+
+	return t
+}
+
+// CompactToTarget decodes the compact bits of a block header, a base 256 exponent in the highest byte
+// followed by a 3 bytes mantissa, the same encoding Bitcoin uses.
+func CompactToTarget(bits uint32) (Target, error) {
+	if bits&0x00800000 != 0 {
+		return Target{}, fmt.Errorf("invalid compact target %08x. Target can't be negative", bits)
+	}
+
+	exponent := uint(bits >> 24)
+	v := big.NewInt(int64(bits & 0x007fffff))
+
+	if exponent <= 3 {
+		v.Rsh(v, 8*(3-exponent))
+	} else {
+		v.Lsh(v, 8*(exponent-3))
+	}
+
+	if v.Sign() == 0 {
+		return Target{}, fmt.Errorf("invalid compact target %08x. Target can't be zero", bits)
+	}
+
+	if v.BitLen() > 256 {
+		return Target{}, fmt.Errorf("invalid compact target %08x. Target overflows 256 bits", bits)
+	}
+
+	var t Target
+	v.FillBytes(t[:])
+
+	return t, nil
+}
+
+// TargetToCompact encodes the target as compact bits, keeping its 3 most significant bytes.
+func TargetToCompact(t Target) uint32 {
+	v := t.Big()
+	size := uint(len(v.Bytes()))
+
+	var mantissa uint64
+	if size <= 3 {
+		mantissa = v.Uint64() << (8 * (3 - size))
+	} else {
+		mantissa = new(big.Int).Rsh(v, 8*(size-3)).Uint64()
+	}
+
+	// The highest mantissa bit is the sign, move a set one into the exponent
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		size++
+	}
+
+	return uint32(size)<<24 | uint32(mantissa)
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"encoding/hex"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestCompactTarget(t *testing.T) {
+	tests := []struct {
+		bits   uint32
+		target string
+	}{
+		{0x1d00ffff, "00000000ffff0000000000000000000000000000000000000000000000000000"},
+		{0x1b0404cb, "00000000000404cb000000000000000000000000000000000000000000000000"},
+		{0x2000ffff, "00ffff0000000000000000000000000000000000000000000000000000000000"},
+		{0x03123456, "0000000000000000000000000000000000000000000000000000000000123456"},
+	}
+
+	for _, tc := range tests {
+		target, err := CompactToTarget(tc.bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if hex.EncodeToString(target[:]) != tc.target {
+			t.Errorf("bits %08x target must be '%s', got '%x'", tc.bits, tc.target, target)
+		}
+
+		if bits := TargetToCompact(target); bits != tc.bits {
+			t.Errorf("target '%x' bits must be %08x, got %08x", target, tc.bits, bits)
+		}
+	}
+
+	for _, bits := range []uint32{0, 0x1d000000, 0x1d800001, 0x23010000} {
+		if _, err := CompactToTarget(bits); err == nil {
+			t.Errorf("bits %08x must be invalid", bits)
+		}
+	}
+
+	if bits := TargetToCompact(DifficultyTarget(1)); bits != 0x2000ffff {
+		t.Errorf("difficulty 1 target bits must be 2000ffff, got %08x", bits)
+	}
+}
+
+func TestHash_MeetsTarget(t *testing.T) {
+	target, err := CompactToTarget(0x1f00ffff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	below := Hash{0x00, 0x00, 0xfe}
+	equal := Hash(target)
+	above := equal
+	above[31] = 0x01
+
+	if !below.MeetsTarget(&target) || !equal.MeetsTarget(&target) {
+		t.Fatalf("hashes not exceeding the target must meet it")
+	}
+
+	if above.MeetsTarget(&target) {
+		t.Fatalf("hash '%x' exceeds the target", above)
+	}
+
+	// More zero bytes than the difficulty requires are fine since TIP6 fork only
+	difficultyTarget := DifficultyTarget(2)
+	if !(Hash{}).MeetsPoW(&difficultyTarget, true) {
+		t.Fatalf("hash of zeroes must meet any target since TIP6 fork")
+	}
+
+	if IsBlockHashValid(Hash{}, 2) || !IsBlockHashValid(Hash{0x00, 0x00, 0x01}, 2) {
+		t.Fatalf("hash must start with exactly the difficulty zero bytes before TIP6 fork")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		below.MeetsTarget(&target)
+	})
+	if allocs != 0 {
+		t.Fatalf("target comparison must not allocate, got %v allocations", allocs)
+	}
+
+	for d := uint(1); d <= 4; d++ {
+		if work := DifficultyTarget(d).Work(); work.Cmp(BlockWork(d)) != 0 {
+			t.Errorf("difficulty %d target work must be %v, got %v", d, BlockWork(d), work)
+		}
+	}
+}
+
+func TestState_BitsRetarget(t *testing.T) {
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+
+	// Blocks mined every second are way faster than the 60 seconds target
+	dataDir := setupTestDataDirWithGenesis(t, Genesis{
+		Balances:        map[common.Address]uint{miner: 1000},
+		TargetBlockTime: 60,
+		Difficulty:      testMiningDifficulty,
+		Forks:           map[string]uint64{ForkTIP6: 0},
+	})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	mineBlock := func(parent Hash, number uint64, bits uint32) Block {
+		b := NewBlock(parent, number, 0, 1650000000+number, miner, nil)
+		b.Header.Bits = bits
+
+		return mineTestPreparedBlock(t, b)
+	}
+
+	initialBits := TargetToCompact(DifficultyTarget(testMiningDifficulty))
+	initialTarget, err := CompactToTarget(initialBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent := Hash{}
+	for number := uint64(0); number < DifficultyRetargetInterval; number++ {
+		if bits := state.NextBits(); bits != initialBits {
+			t.Fatalf("block %d bits must be %08x, got %08x", number, initialBits, bits)
+		}
+
+		parent = addTestBlock(t, state, mineBlock(parent, number, initialBits))
+	}
+
+	expectedWork := new(big.Int).Mul(initialTarget.Work(), big.NewInt(DifficultyRetargetInterval))
+	if state.ChainWork().Cmp(expectedWork) != 0 {
+		t.Fatalf("chain work must be %v, got %v", expectedWork, state.ChainWork())
+	}
+
+	// The retarget is limited to a maxRetargetFactor times harder target
+	expectedBits := TargetToCompact(targetFromBig(new(big.Int).Div(initialTarget.Big(), big.NewInt(maxRetargetFactor))))
+	if bits := state.NextBits(); bits != expectedBits {
+		t.Fatalf("bits must be retargeted to %08x, got %08x", expectedBits, bits)
+	}
+
+	stale := mineBlock(parent, DifficultyRetargetInterval, initialBits)
+	if _, err := state.AddBlock(stale); err == nil {
+		t.Fatalf("block committing the previous bits must be rejected")
+	}
+
+	addTestBlock(t, state, mineBlock(parent, DifficultyRetargetInterval, expectedBits))
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const TxRewardData = "reward"
+
+// RewardShare is a beneficiary of the block reward, paid in proportion to its Weight.
+type RewardShare struct {
+	Account common.Address `json:"account"`
+	Weight  uint           `json:"weight"`
+}
+
+// NewRewardTx returns a TX minting value to the beneficiary in the block at the given height.
+//
+// Reward TXs are not signed, they are sent from the zero address and their nonce is the block number,
+// so the reward TXs of different blocks never share a hash.
+func NewRewardTx(to common.Address, value uint, number uint64, time uint64) SignedTx {
+	return SignedTx{
+		Tx: Tx{
+			To:    to,
+			Value: value,
+			Nonce: uint(number),
+			Data:  TxRewardData,
+			Time:  time,
+		},
+	}
+}
+
+// NewRewardTxs splits the reward among the beneficiaries in proportion to their weights, the rounding
+// remainder going to the first one. Every account must be listed at most once.
+//
+// Beneficiaries whose share rounds down to zero are left out.
+func NewRewardTxs(reward uint, number uint64, time uint64, shares []RewardShare) []SignedTx {
+	totalWeight := uint(0)
+	for _, share := range shares {
+		totalWeight += share.Weight
+	}
+
+	txs := make([]SignedTx, 0, len(shares))
+	if reward == 0 || totalWeight == 0 {
+		return txs
+	}
+
+	values := make([]uint, len(shares))
+	paid := uint(0)
+
+	for i, share := range shares {
+		values[i] = reward / totalWeight * share.Weight
+		values[i] += reward % totalWeight * share.Weight / totalWeight
+		paid += values[i]
+	}
+	values[0] += reward - paid
+
+	for i, share := range shares {
+		if values[i] > 0 {
+			txs = append(txs, NewRewardTx(share.Account, values[i], number, time))
+		}
+	}
+
+	return txs
+}
+
+// RewardTxs returns the reward TXs the block starts with since TIP7 fork.
+func (b Block) RewardTxs() []SignedTx {
+	rewards, _ := splitRewardTxs(b.Txs)
+
+	return rewards
+}
+
+// NextBlockReward returns the block reward with the fees of the TXs the next block pays to its beneficiaries.
+func (s *State) NextBlockReward(txs []SignedTx) uint {
+	return minerReward(Block{Txs: txs}, s.Rules())
+}
+
+// splitRewardTxs splits the TXs into the leading reward TXs and the transfers following them.
+func splitRewardTxs(txs []SignedTx) ([]SignedTx, []SignedTx) {
+	i := 0
+	for i < len(txs) && txs[i].IsReward() {
+		i++
+	}
+
+	return txs[:i], txs[i:]
+}
+
+// verifyRewardTxs checks the reward TXs mint exactly the block reward with the fees, each to a different beneficiary.
+func verifyRewardTxs(b Block, rewards []SignedTx, reward uint) error {
+	beneficiaries := make(map[common.Address]struct{})
+	total := uint(0)
+
+	for _, tx := range rewards {
+		if tx.Nonce != uint(b.Header.Number) || tx.Time != b.Header.Time {
+			return fmt.Errorf("invalid reward TX. Nonce must be the block number '%d' and time the block time '%d'", b.Header.Number, b.Header.Time)
+		}
+
+		if tx.Gas != 0 || tx.GasPrice != 0 || tx.MaxFee != 0 || tx.Tip != 0 || tx.ChainID != 0 || len(tx.Sig) != 0 {
+			return fmt.Errorf("invalid reward TX. `Gas`, `GasPrice`, `MaxFee`, `Tip`, `ChainID` and `Sig` can't be populated")
+		}
+
+		if tx.Value == 0 {
+			return fmt.Errorf("invalid reward TX. Beneficiary '%s' is paid nothing", tx.To.String())
+		}
+
+		if _, ok := beneficiaries[tx.To]; ok {
+			return fmt.Errorf("invalid reward TX. Beneficiary '%s' is paid twice", tx.To.String())
+		}
+		beneficiaries[tx.To] = struct{}{}
+
+		if total+tx.Value < total {
+			return fmt.Errorf("invalid reward TX. Rewards overflow")
+		}
+		total += tx.Value
+	}
+
+	if total != reward {
+		return fmt.Errorf("invalid block. Reward TXs mint %d GC, the block reward with the fees is %d GC", total, reward)
+	}
+
+	return nil
+}
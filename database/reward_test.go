@@ -0,0 +1,146 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestNewRewardTxs(t *testing.T) {
+	a := NewAccount("0x00000000000000000000000000000000000000aa")
+	b := NewAccount("0x00000000000000000000000000000000000000bb")
+	c := NewAccount("0x00000000000000000000000000000000000000cc")
+
+	txs := NewRewardTxs(100, 5, 1650000005, []RewardShare{{a, 1}, {b, 1}, {c, 1}})
+	if len(txs) != 3 || txs[0].Value != 34 || txs[1].Value != 33 || txs[2].Value != 33 {
+		t.Fatalf("reward must be split 34/33/33 with the remainder to the first beneficiary, got %+v", txs)
+	}
+
+	for _, tx := range txs {
+		if !tx.IsReward() || tx.Nonce != 5 || tx.Time != 1650000005 {
+			t.Fatalf("unexpected reward TX %+v", tx)
+		}
+	}
+
+	txs = NewRewardTxs(10, 0, 0, []RewardShare{{a, 1}, {b, 100}})
+	if len(txs) != 2 || txs[0].Value != 1 || txs[1].Value != 9 {
+		t.Fatalf("reward must be split 1/9, got %+v", txs)
+	}
+
+	txs = NewRewardTxs(1, 0, 0, []RewardShare{{a, 1}, {b, 100}})
+	if len(txs) != 1 || txs[0].To != a || txs[0].Value != 1 {
+		t.Fatalf("beneficiaries paid nothing must be left out, got %+v", txs)
+	}
+
+	if txs := NewRewardTxs(0, 0, 0, []RewardShare{{a, 1}}); len(txs) != 0 {
+		t.Fatalf("zero reward must not create reward TXs, got %+v", txs)
+	}
+}
+
+func TestState_RewardTxs(t *testing.T) {
+	senderKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(senderKey.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+	pool := NewAccount("0x00000000000000000000000000000000000000bb")
+
+	dataDir := setupTestDataDirWithGenesis(t, Genesis{
+		Balances: map[common.Address]uint{sender: 1000},
+		Forks:    map[string]uint64{ForkTIP7: 0},
+	})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	tx := signTestTx(t, NewBaseTx(sender, receiver, 10, 1, ""), senderKey)
+	reward := state.NextBlockReward([]SignedTx{tx})
+	if reward != BlockReward+tx.GasCost() {
+		t.Fatalf("next block reward must be %d, got %d", BlockReward+tx.GasCost(), reward)
+	}
+
+	shares := []RewardShare{{miner, 3}, {pool, 1}}
+	time := uint64(1650000000)
+
+	invalid := map[string][]SignedTx{
+		"missing rewards": {tx},
+		"short reward":    append(NewRewardTxs(reward-1, 0, time, shares), tx),
+		"excess reward":   append(NewRewardTxs(reward+1, 0, time, shares), tx),
+		"paid twice": {
+			NewRewardTx(miner, reward/2, 0, time),
+			NewRewardTx(miner, reward-reward/2, 0, time),
+			tx,
+		},
+		"wrong number": append(NewRewardTxs(reward, 1, time, shares), tx),
+	}
+
+	for name, txs := range invalid {
+		if _, err := state.AddBlock(mineTestBlock(t, Hash{}, 0, miner, txs)); err == nil {
+			t.Errorf("%s: block must be rejected", name)
+		}
+	}
+
+	rewards := NewRewardTxs(reward, 0, time, shares)
+	b := mineTestBlock(t, Hash{}, 0, miner, append(rewards, tx))
+	hash := addTestBlock(t, state, b)
+
+	if len(b.RewardTxs()) != 2 {
+		t.Fatalf("block must start with 2 reward TXs, got %+v", b.RewardTxs())
+	}
+
+	if state.Balances[miner] != rewards[0].Value || state.Balances[pool] != rewards[1].Value || rewards[0].Value+rewards[1].Value != reward {
+		t.Fatalf("beneficiaries must be paid the split reward, got %+v", state.Balances)
+	}
+
+	if supply := state.Supply(); supply.Burned != 0 || supply.Circulating != 1000+BlockReward {
+		t.Fatalf("reward TXs must mint exactly the block reward, got %+v", supply)
+	}
+
+	history, err := state.GetAddressHistory(pool, AddressHistoryFilter{Direction: HistoryReward})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if history.Total != 1 || history.Txs[0].Value != rewards[1].Value || history.Txs[0].TxHash.IsEmpty() {
+		t.Fatalf("beneficiary must have 1 reward entry with its TX hash, got %+v", history)
+	}
+
+	history, err = state.GetAddressHistory(miner, AddressHistoryFilter{Direction: HistoryReward})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if history.Total != 1 || history.Txs[0].Value != rewards[0].Value {
+		t.Fatalf("miner must only have its reward TX entry, got %+v", history)
+	}
+
+	// The reward TXs of the next block differ by their nonce
+	next := NewRewardTxs(BlockReward, 1, time+1, shares)
+	addTestBlock(t, state, mineTestBlock(t, hash, 1, miner, next))
+}
+
+func TestState_RewardTxsBeforeFork(t *testing.T) {
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+
+	dataDir := setupTestDataDir(t, map[common.Address]uint{miner: 1000})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	rewards := NewRewardTxs(BlockReward, 0, 1650000000, []RewardShare{{miner, 1}})
+	if _, err := state.AddBlock(mineTestBlock(t, Hash{}, 0, miner, rewards)); err == nil {
+		t.Fatalf("reward TXs must be rejected before TIP7 fork")
+	}
+}
@@ -0,0 +1,366 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DefaultSnapshotInterval is how often, in blocks, the State persists a snapshot of itself.
+const DefaultSnapshotInterval = 1000
+
+// Snapshot is the State after applying the block at Height, used to boot without replaying the whole chain.
+type Snapshot struct {
+	Height           uint64                  `json:"height"`
+	Hash             Hash                    `json:"hash"`
+	MiningDifficulty uint                    `json:"mining_difficulty"`
+	ChainWork        *big.Int                `json:"chain_work"`
+	Balances         map[common.Address]uint `json:"balances"`
+	Account2Nonce    map[common.Address]uint `json:"nonces"`
+	BlockTimes       []uint64                `json:"block_times,omitempty"`
+	ImmatureRewards  []ImmatureReward        `json:"immature_rewards,omitempty"`
+	Genesis          Hash                    `json:"genesis"`
+
+	Checksum Hash `json:"checksum"`
+}
+
+// CreateSnapshot persists a snapshot of the State at the latest block.
+func (s *State) CreateSnapshot() (Snapshot, error) {
+	if !s.hasGenesisBlock {
+		return Snapshot{}, fmt.Errorf("can't snapshot an empty blockchain")
+	}
+
+	snapshot := Snapshot{
+		Height:           s.latestBlock.Header.Number,
+		Hash:             s.latestBlockHash,
+		MiningDifficulty: s.miningDifficulty,
+		ChainWork:        s.ChainWork(),
+		Balances:         s.Balances,
+		Account2Nonce:    s.Account2Nonce,
+		BlockTimes:       s.blockTimes,
+		ImmatureRewards:  s.immature,
+		Genesis:          s.GenesisHash(),
+	}
+
+	var err error
+	snapshot.Checksum, err = snapshot.computeChecksum()
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	snapshotJson, err := json.Marshal(snapshot)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	if err := os.MkdirAll(getSnapshotsDirPath(s.dataDir), os.ModePerm); err != nil {
+		return Snapshot{}, err
+	}
+
+	// Write to a temporary file first so a crash never leaves a half written snapshot behind
+	path := getSnapshotFilePath(s.dataDir, snapshot.Height)
+	if err := ioutil.WriteFile(path+".tmp", snapshotJson, 0600); err != nil {
+		return Snapshot{}, err
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return Snapshot{}, err
+	}
+
+	return snapshot, nil
+}
+
+// snapshotIfDue creates a snapshot every snapshotInterval blocks, unless a valid one already exists.
+func (s *State) snapshotIfDue() {
+	height := s.latestBlock.Header.Number
+	if height == 0 || height%s.snapshotInterval != 0 {
+		return
+	}
+
+	if existing, err := loadSnapshot(s.dataDir, height); err == nil && existing.Hash == s.latestBlockHash && existing.Verify() == nil {
+		return
+	}
+
+	if _, err := s.CreateSnapshot(); err != nil {
+		fmt.Printf("ERROR: unable to create State snapshot: %s\n", err)
+	}
+}
+
+// Verify checks the snapshot's checksum.
+func (sn Snapshot) Verify() error {
+	checksum, err := sn.computeChecksum()
+	if err != nil {
+		return err
+	}
+
+	if checksum != sn.Checksum {
+		return fmt.Errorf("snapshot at height %d checksum is '%x', expected '%x'", sn.Height, checksum, sn.Checksum)
+	}
+
+	return nil
+}
+
+func (sn Snapshot) computeChecksum() (Hash, error) {
+	sn.Checksum = Hash{}
+
+	snapshotJson, err := json.Marshal(sn)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	return sha256.Sum256(snapshotJson), nil
+}
+
+// ListSnapshots returns all the snapshots found in the data dir, from the oldest.
+func ListSnapshots(dataDir string) ([]Snapshot, error) {
+	snapshots := make([]Snapshot, 0)
+
+	files, err := ioutil.ReadDir(getSnapshotsDirPath(dataDir))
+	if os.IsNotExist(err) {
+		return snapshots, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		height, err := strconv.ParseUint(strings.TrimSuffix(file.Name(), ".json"), 10, 64)
+		if err != nil || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		snapshot, err := loadSnapshot(dataDir, height)
+		if err != nil {
+			return nil, err
+		}
+
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Height < snapshots[j].Height
+	})
+
+	return snapshots, nil
+}
+
+// VerifySnapshots replays the whole blockchain and compares every snapshot with the replayed State.
+// It returns the verification error of every snapshot by its height, nil if the snapshot is valid.
+//
+// The replay starts from the genesis difficulty, the given mining difficulty is only used by chains without one.
+func VerifySnapshots(dataDir string, miningDifficulty uint) (map[uint64]error, error) {
+	snapshots, err := ListSnapshots(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[uint64]error)
+	pending := make(map[uint64]Snapshot)
+
+	for _, snapshot := range snapshots {
+		if err := snapshot.Verify(); err != nil {
+			results[snapshot.Height] = err
+			continue
+		}
+		pending[snapshot.Height] = snapshot
+	}
+
+	state, err := newStateFromGenesis(dataDir, miningDifficulty, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer state.Close()
+
+	err = state.replay(0, func(blockFs BlockFS) error {
+		snapshot, ok := pending[blockFs.Value.Header.Number]
+		if !ok {
+			return nil
+		}
+
+		results[snapshot.Height] = snapshot.matches(state)
+		delete(pending, snapshot.Height)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for height := range pending {
+		results[height] = fmt.Errorf("snapshot at height %d is above the latest block", height)
+	}
+
+	return results, nil
+}
+
+// matches reports how the snapshot differs from the State.
+func (sn Snapshot) matches(s *State) error {
+	if sn.Genesis != s.GenesisHash() {
+		return fmt.Errorf("snapshot was created from a different genesis")
+	}
+
+	if sn.Hash != s.latestBlockHash {
+		return fmt.Errorf("snapshot block '%x' is not part of the main chain, expected '%x'", sn.Hash, s.latestBlockHash)
+	}
+
+	if sn.ChainWork == nil || sn.ChainWork.Cmp(s.chainWork) != 0 {
+		return fmt.Errorf("snapshot chain work is %v, expected %v", sn.ChainWork, s.chainWork)
+	}
+
+	if !equalAccounts(sn.Balances, s.Balances) {
+		return fmt.Errorf("snapshot balances don't match the replayed balances")
+	}
+
+	if !equalAccounts(sn.Account2Nonce, s.Account2Nonce) {
+		return fmt.Errorf("snapshot nonces don't match the replayed nonces")
+	}
+
+	if s.config.Rules(sn.Height).IsTIP5 && sn.MiningDifficulty != s.miningDifficulty {
+		return fmt.Errorf("snapshot mining difficulty is %d, expected %d", sn.MiningDifficulty, s.miningDifficulty)
+	}
+
+	if !equalBlockTimes(sn.BlockTimes, s.blockTimes) {
+		return fmt.Errorf("snapshot block times don't match the replayed block times")
+	}
+
+	if !equalImmatureRewards(sn.ImmatureRewards, s.immature) {
+		return fmt.Errorf("snapshot immature rewards don't match the replayed immature rewards")
+	}
+
+	return nil
+}
+
+// loadLatestSnapshot restores the State from the most recent valid snapshot which still leaves
+// MaxReorgDepth blocks to replay, so the State is able to reorg right after booting.
+func (s *State) loadLatestSnapshot() error {
+	snapshot, blockFs, err := s.latestSnapshot(func(snapshot Snapshot) bool {
+		_, err := s.store.BlockByHeight(snapshot.Height + MaxReorgDepth)
+		return err == nil
+	})
+	if err != nil || snapshot == nil {
+		return err
+	}
+
+	fmt.Printf("Loading State snapshot at height %d\n", snapshot.Height)
+
+	s.restoreSnapshot(*snapshot, blockFs)
+
+	return nil
+}
+
+// latestSnapshot returns the most recent valid snapshot of a main chain block accepted by the filter, nil if none.
+func (s *State) latestSnapshot(accept func(Snapshot) bool) (*Snapshot, BlockFS, error) {
+	snapshots, err := ListSnapshots(s.dataDir)
+	if err != nil {
+		return nil, BlockFS{}, err
+	}
+
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		snapshot := snapshots[i]
+
+		if err := snapshot.Verify(); err != nil {
+			fmt.Printf("Skipping snapshot: %s\n", err)
+			continue
+		}
+
+		// Snapshots without block times predate the difficulty retargeting and can't be restored from
+		if snapshot.Genesis != s.GenesisHash() || snapshot.ChainWork == nil || len(snapshot.BlockTimes) == 0 || !accept(snapshot) {
+			continue
+		}
+
+		blockFs, err := s.store.BlockByHeight(snapshot.Height)
+		if err != nil || blockFs.Key != snapshot.Hash {
+			continue
+		}
+
+		return &snapshot, blockFs, nil
+	}
+
+	return nil, BlockFS{}, nil
+}
+
+func (s *State) restoreSnapshot(snapshot Snapshot, blockFs BlockFS) {
+	s.Balances = snapshot.Balances
+	s.Account2Nonce = snapshot.Account2Nonce
+	s.accounts = nil
+	s.latestBlock = blockFs.Value
+	s.latestBlockHash = blockFs.Key
+	s.hasGenesisBlock = true
+	s.chainWork = snapshot.ChainWork
+	s.blockTimes = snapshot.BlockTimes
+	s.baseFee = s.NextBaseFee()
+	s.immature = snapshot.ImmatureRewards
+
+	// The difficulty is retargeted since TIP5 fork, before it's the node's one
+	if s.config.Rules(snapshot.Height).IsTIP5 {
+		s.miningDifficulty = snapshot.MiningDifficulty
+	}
+}
+
+func loadSnapshot(dataDir string, height uint64) (Snapshot, error) {
+	content, err := ioutil.ReadFile(getSnapshotFilePath(dataDir, height))
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	// An unreadable snapshot is returned empty and fails its checksum verification
+	var snapshot Snapshot
+	if err := json.Unmarshal(content, &snapshot); err != nil {
+		return Snapshot{Height: height}, nil
+	}
+
+	if snapshot.Balances == nil {
+		snapshot.Balances = make(map[common.Address]uint)
+	}
+
+	if snapshot.Account2Nonce == nil {
+		snapshot.Account2Nonce = make(map[common.Address]uint)
+	}
+
+	return snapshot, nil
+}
+
+func equalAccounts(a, b map[common.Address]uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for acc, value := range a {
+		if other, ok := b[acc]; !ok || other != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func equalBlockTimes(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func getSnapshotsDirPath(dataDir string) string {
+	return filepath.Join(getDatabaseDirPath(dataDir), "snapshots")
+}
+
+func getSnapshotFilePath(dataDir string, height uint64) string {
+	return filepath.Join(getSnapshotsDirPath(dataDir), fmt.Sprintf("%d.json", height))
+}
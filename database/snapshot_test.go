@@ -0,0 +1,129 @@
+package database
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestState_BootFromSnapshot(t *testing.T) {
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+
+	dataDir := setupTestDataDir(t, map[common.Address]uint{miner: 1000})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.snapshotInterval = 10
+
+	parent := Hash{}
+	for i := uint64(0); i < MaxReorgDepth+25; i++ {
+		parent = addTestBlock(t, state, mineTestBlock(t, parent, i, miner, nil))
+	}
+
+	expectedBalance := state.Balances[miner]
+
+	if err := state.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots, err := ListSnapshots(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snapshots) != 12 {
+		t.Fatalf("expected 12 snapshots, got %d", len(snapshots))
+	}
+
+	results, err := VerifySnapshots(dataDir, testMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for height, err := range results {
+		if err != nil {
+			t.Errorf("snapshot at height %d must be valid: %s", height, err)
+		}
+	}
+
+	// Reformatting the genesis.json keeps the genesis hash, so the snapshots stay usable
+	gen, err := loadGenesis(getGenesisJsonFilePath(dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genesisJson, err := json.MarshalIndent(gen, "", "    ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(getGenesisJsonFilePath(dataDir), genesisJson, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the latest snapshot leaving enough blocks to reorg, the previous one must be used
+	err = ioutil.WriteFile(getSnapshotFilePath(dataDir, 20), []byte(`{"height":20}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tamper with the previous snapshot keeping it consistent, so booting from it is observable
+	tampered, err := loadSnapshot(dataDir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered.Balances[NewAccount("0x00000000000000000000000000000000000000bb")] = 42
+	tampered.Checksum, err = tampered.computeChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tamperedJson, err := json.Marshal(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(getSnapshotFilePath(dataDir, 10), tamperedJson, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reloaded.LatestBlockHash() != parent {
+		t.Fatalf("latest block must be '%x', got '%x'", parent, reloaded.LatestBlockHash())
+	}
+
+	if reloaded.Balances[miner] != expectedBalance {
+		t.Fatalf("miner balance must be %d, got %d", expectedBalance, reloaded.Balances[miner])
+	}
+
+	if reloaded.Balances[NewAccount("0x00000000000000000000000000000000000000bb")] != 42 {
+		t.Fatal("State must boot from the latest usable snapshot at height 10")
+	}
+
+	if err := reloaded.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err = VerifySnapshots(dataDir, testMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results[20] == nil || results[10] == nil {
+		t.Fatal("corrupted and tampered snapshots must fail the verification")
+	}
+
+	if results[30] != nil {
+		t.Fatalf("snapshot at height 30 must be valid: %s", results[30])
+	}
+}
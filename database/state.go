@@ -1,10 +1,8 @@
 package database
 
 import (
-	"bufio"
-	"encoding/json"
 	"fmt"
-	"os"
+	"math/big"
 	"reflect"
 	"sort"
 
@@ -19,21 +17,83 @@ type State struct {
 	Balances      map[common.Address]uint
 	Account2Nonce map[common.Address]uint
 
-	dbFile *os.File
+	dataDir     string
+	genesisHash Hash
+	store       BlockStore
+	txIndex     *TxIndex
 
 	latestBlock     Block
 	latestBlockHash Hash
 	hasGenesisBlock bool
 
 	miningDifficulty uint
-	forkTIP1         uint64
+	config           ChainConfig
 
-	HashCache   map[string]int64
-	HeightCache map[uint64]int64
+	// The base fee of the next block, see NextBaseFee. It's cached for the Rules every TX is validated with.
+	baseFee uint
+
+	// The State tree of the accounts, built by the first StateRoot
+	accounts *accountsTree
+
+	// The times of the latest main chain blocks, oldest first, the difficulty is retargeted from
+	blockTimes []uint64
+
+	// The block rewards and fees not spendable by the next block yet, oldest first
+	immature []ImmatureReward
+
+	snapshotInterval uint64
+
+	// The most recent main chain blocks which can be rolled back, oldest first
+	mainChain  []*chainBlock
+	sideBlocks map[Hash]*chainBlock
+	chainWork  *big.Int
 }
 
-func NewStateFromDisk(dataDir string, miningDifficulty uint) (*State, error) {
-	if err := InitDataDirIfNotExists(dataDir, []byte(genesisJson)); err != nil {
+// NewStateFromDisk loads the genesis, completes an interrupted reorg, restores the latest State snapshot
+// and replays the blocks after it.
+//
+// A nil store opens the BlockStore the data dir was created with.
+func NewStateFromDisk(dataDir string, miningDifficulty uint, store BlockStore) (*State, error) {
+	state, err := newStateFromGenesis(dataDir, miningDifficulty, store)
+	if err != nil {
+		return nil, err
+	}
+
+	err = completeReorg(dataDir, state.store)
+	if err != nil {
+		_ = state.Close()
+		return nil, err
+	}
+
+	err = state.loadLatestSnapshot()
+	if err != nil {
+		_ = state.Close()
+		return nil, err
+	}
+
+	fromHeight := state.NextBlockNumber()
+
+	err = state.replay(fromHeight, func(BlockFS) error {
+		state.snapshotIfDue()
+		return nil
+	})
+	if err != nil {
+		_ = state.Close()
+		return nil, err
+	}
+
+	state.txIndex, err = openTxIndex(dataDir, state.store, state.config)
+	if err != nil {
+		_ = state.Close()
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// newStateFromGenesis returns the State before the first block.
+func newStateFromGenesis(dataDir string, miningDifficulty uint, store BlockStore) (*State, error) {
+	if err := checkDataDirInitialized(dataDir); err != nil {
 		return nil, err
 	}
 
@@ -42,68 +102,85 @@ func NewStateFromDisk(dataDir string, miningDifficulty uint) (*State, error) {
 		return nil, err
 	}
 
-	balances := make(map[common.Address]uint)
-	for account, balance := range gen.Balances {
-		balances[account] = balance
+	genesisHash, err := verifyGenesisHash(dataDir, gen)
+	if err != nil {
+		return nil, err
 	}
 
-	account2nonce := make(map[common.Address]uint)
+	if store == nil {
+		store, err = OpenBlockStore(dataDir, "")
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	dbFilepath := getBlocksDbFilePath(dataDir)
-	dbFile, err := os.OpenFile(dbFilepath, os.O_RDWR|os.O_APPEND, 0600)
+	state, err := newGenesisState(gen, dataDir, miningDifficulty, store)
 	if err != nil {
 		return nil, err
 	}
+	state.genesisHash = genesisHash
 
-	scanner := bufio.NewScanner(dbFile)
+	return state, nil
+}
+
+// newGenesisState returns the State of the genesis, before the first block.
+//
+// The genesis difficulty, if set, overrides the given mining difficulty.
+func newGenesisState(gen Genesis, dataDir string, miningDifficulty uint, store BlockStore) (*State, error) {
+	config, err := gen.ChainConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Difficulty != 0 {
+		miningDifficulty = config.Difficulty
+	}
+
+	balances := make(map[common.Address]uint)
+	for account, balance := range gen.Balances {
+		balances[account] = balance
+	}
+
+	account2nonce := make(map[common.Address]uint)
 
 	state := &State{
 		Balances:         balances,
 		Account2Nonce:    account2nonce,
-		dbFile:           dbFile,
+		dataDir:          dataDir,
+		store:            store,
 		latestBlock:      Block{},
 		latestBlockHash:  Hash{},
 		hasGenesisBlock:  false,
 		miningDifficulty: miningDifficulty,
-		forkTIP1:         gen.ForkTIP1,
-		HashCache:        map[string]int64{},
-		HeightCache:      map[uint64]int64{},
+		config:           config,
+		snapshotInterval: DefaultSnapshotInterval,
+		mainChain:        make([]*chainBlock, 0),
+		sideBlocks:       make(map[Hash]*chainBlock),
+		chainWork:        big.NewInt(0),
 	}
+	state.baseFee = state.NextBaseFee()
 
-	var filePosition int64
-
-	for scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			return nil, err
-		}
-
-		blockFsJson := scanner.Bytes()
-
-		if len(blockFsJson) == 0 {
-			break
-		}
-
-		var blockFs BlockFS
-
-		if err := json.Unmarshal(blockFsJson, &blockFs); err != nil {
-			return nil, err
-		}
+	return state, nil
+}
 
-		if err := applyBlock(blockFs.Value, state); err != nil {
-			return nil, err
+// replay applies the stored blocks starting at the given height, calling fn after each of them.
+// Returning errStopReplay from fn stops the replay without an error.
+func (s *State) replay(fromHeight uint64, fn func(BlockFS) error) error {
+	err := s.store.Iterate(fromHeight, func(blockFs BlockFS) error {
+		pendingState := s.Copy()
+		if err := applyBlock(blockFs.Value, &pendingState); err != nil {
+			return err
 		}
 
-		// Set search caches
-		state.HashCache[blockFs.Key.Hex()] = filePosition
-		state.HeightCache[blockFs.Value.Header.Number] = filePosition
-		filePosition += int64(len(blockFsJson)) + 1
+		s.commitBlock(&pendingState, blockFs.Key, blockFs.Value, newAccountsUndo(s, &pendingState))
 
-		state.latestBlock = blockFs.Value
-		state.latestBlockHash = blockFs.Key
-		state.hasGenesisBlock = true
+		return fn(blockFs)
+	})
+	if err == errStopReplay {
+		return nil
 	}
 
-	return state, nil
+	return err
 }
 
 func (s *State) AddBlocks(blocks []Block) error {
@@ -118,52 +195,87 @@ func (s *State) AddBlocks(blocks []Block) error {
 }
 
 func (s *State) AddBlock(b Block) (Hash, error) {
-	pendingState := s.Copy()
+	hash, _, err := s.ImportBlock(b)
 
-	err := applyBlock(b, &pendingState)
-	if err != nil {
-		return Hash{}, err
-	}
+	return hash, err
+}
 
+// ImportBlock adds the block on top of the main chain or, if it extends a different branch, keeps it
+// as a side branch. Once a side branch accumulates more work than the main chain, the State is reorganized
+// onto it and the returned Reorg describes which blocks were detached and attached.
+func (s *State) ImportBlock(b Block) (Hash, *Reorg, error) {
 	blockHash, err := b.Hash()
 	if err != nil {
-		return Hash{}, err
+		return Hash{}, nil, err
 	}
 
-	blockFs := BlockFS{
-		Key:   blockHash,
-		Value: b,
+	if s.IsKnownBlock(blockHash) {
+		return blockHash, nil, nil
 	}
 
-	blockFsJson, err := json.Marshal(blockFs)
-	if err != nil {
-		return Hash{}, err
+	if s.hasGenesisBlock && b.Header.Parent != s.latestBlockHash {
+		reorg, err := s.addSideBlock(b, blockHash)
+		if err != nil {
+			return Hash{}, nil, err
+		}
+
+		return blockHash, reorg, nil
 	}
 
-	fmt.Printf("\nPersisting new Block to disk:\n")
-	fmt.Printf("\t%s\n", blockFsJson)
+	pendingState := s.Copy()
+
+	err = applyBlock(b, &pendingState)
+	if err != nil {
+		return Hash{}, nil, err
+	}
 
-	// Get file position for cache
-	fs, _ := s.dbFile.Stat()
-	filePosition := fs.Size() + 1
+	undo := newAccountsUndo(s, &pendingState)
 
-	_, err = s.dbFile.Write(append(blockFsJson, '\n'))
+	err = s.persistBlock(blockHash, b, newAccountsDiff(blockHash, undo, &pendingState))
 	if err != nil {
-		return Hash{}, err
+		return Hash{}, nil, err
+	}
+
+	s.commitBlock(&pendingState, blockHash, b, undo)
+
+	s.snapshotIfDue()
+
+	return blockHash, nil, nil
+}
+
+// persistBlock appends the block to the BlockStore and indexes its TXs and accountsDiff.
+func (s *State) persistBlock(blockHash Hash, b Block, diff accountsDiff) error {
+	if err := s.store.Append(blockHash, b); err != nil {
+		return err
+	}
+
+	if s.txIndex == nil {
+		return nil
 	}
 
-	// Set search caches
-	s.HashCache[blockFs.Key.Hex()] = filePosition
-	s.HeightCache[blockFs.Value.Header.Number] = filePosition
+	return s.txIndex.indexBlock(blockHash, b, &diff)
+}
+
+// commitBlock makes the pendingState with the block applied the new main chain state,
+// the undo reverting the block.
+func (s *State) commitBlock(pendingState *State, blockHash Hash, b Block, undo accountsUndo) {
+	// The block is valid already, so is its target
+	target, _ := blockTarget(b, pendingState.miningDifficulty)
 
 	s.Balances = pendingState.Balances
 	s.Account2Nonce = pendingState.Account2Nonce
-	s.latestBlockHash = blockHash
-	s.latestBlock = b
-	s.hasGenesisBlock = true
+	s.accounts = pendingState.accounts
 	s.miningDifficulty = pendingState.miningDifficulty
 
-	return blockHash, nil
+	s.connectBlock(&chainBlock{
+		hash:       blockHash,
+		block:      b,
+		work:       new(big.Int).Add(s.chainWork, target.Work()),
+		undo:       undo,
+		difficulty: pendingState.miningDifficulty,
+		blockTimes: pendingState.blockTimes,
+		immature:   pendingState.immature,
+	})
 }
 
 func (s *State) NextBlockNumber() uint64 {
@@ -182,6 +294,34 @@ func (s *State) LatestBlockHash() Hash {
 	return s.latestBlockHash
 }
 
+// NextBlockParent returns the parent hash of the next block, the genesis hash for the first block since TIP12 fork.
+func (s *State) NextBlockParent() Hash {
+	if !s.hasGenesisBlock {
+		return s.firstBlockParent()
+	}
+
+	return s.latestBlockHash
+}
+
+// firstBlockParent returns the parent hash of the first block, empty before TIP12 fork.
+func (s *State) firstBlockParent() Hash {
+	if s.config.Rules(0).IsTIP12 {
+		return s.genesisHash
+	}
+
+	return Hash{}
+}
+
+// MiningDifficulty returns the difficulty the blocks are mined and verified with.
+func (s *State) MiningDifficulty() uint {
+	return s.miningDifficulty
+}
+
+// GenesisHash identifies the chain of the State, see Genesis.Hash.
+func (s *State) GenesisHash() Hash {
+	return s.genesisHash
+}
+
 func (s *State) GetNextAccountNonce(account common.Address) uint {
 	return s.Account2Nonce[account] + 1
 }
@@ -190,12 +330,49 @@ func (s *State) ChangeMiningDifficulty(newDifficulty uint) {
 	s.miningDifficulty = newDifficulty
 }
 
+// ChainConfig returns the consensus parameters and fork schedule of the genesis.
+func (s *State) ChainConfig() ChainConfig {
+	return s.config
+}
+
+// Rules returns the consensus rules of the next block.
+func (s *State) Rules() Rules {
+	rules := s.config.Rules(s.NextBlockNumber())
+	rules.BaseFee = s.baseFee
+
+	return rules
+}
+
 func (s *State) IsTIP1Fork() bool {
-	return s.NextBlockNumber() >= s.forkTIP1
+	return s.Rules().IsTIP1
+}
+
+func (s *State) IsTIP2Fork() bool {
+	return s.Rules().IsTIP2
+}
+
+func (s *State) IsTIP3Fork() bool {
+	return s.Rules().IsTIP3
+}
+
+func (s *State) IsTIP4Fork() bool {
+	return s.Rules().IsTIP4
+}
+
+// ChainID returns the genesis chain ID the TXs are signed for since TIP4 fork.
+func (s *State) ChainID() uint64 {
+	return s.config.ChainID
 }
 
 func (s *State) Close() error {
-	return s.dbFile.Close()
+	if s.txIndex != nil {
+		if err := s.txIndex.Close(); err != nil {
+			_ = s.store.Close()
+			return err
+		}
+	}
+
+	return s.store.Close()
 }
 
 func (s *State) Copy() State {
@@ -206,7 +383,15 @@ func (s *State) Copy() State {
 	c.Balances = make(map[common.Address]uint)
 	c.Account2Nonce = make(map[common.Address]uint)
 	c.miningDifficulty = s.miningDifficulty
-	c.forkTIP1 = s.forkTIP1
+	c.config = s.config
+	c.baseFee = s.baseFee
+	c.blockTimes = s.blockTimes
+	c.immature = s.immature
+	c.genesisHash = s.genesisHash
+
+	if s.accounts != nil {
+		c.accounts = s.accounts.copy()
+	}
 
 	for acc, balance := range s.Balances {
 		c.Balances[acc] = balance
@@ -232,34 +417,192 @@ func applyBlock(b Block, s *State) error {
 		return fmt.Errorf("next block parent hash must be '%x' not '%x'", s.latestBlockHash, b.Header.Parent)
 	}
 
+	if !s.hasGenesisBlock && b.Header.Parent != s.firstBlockParent() {
+		return fmt.Errorf("first block parent hash must be '%x' not '%x'", s.firstBlockParent(), b.Header.Parent)
+	}
+
 	hash, err := b.Hash()
 	if err != nil {
 		return err
 	}
 
-	if !IsBlockHashValid(hash, s.miningDifficulty) {
+	rules := s.Rules()
+
+	difficulty := s.NextDifficulty()
+	target := DifficultyTarget(difficulty)
+
+	if rules.IsTIP6 {
+		if bits := s.NextBits(); b.Header.Bits != bits {
+			return fmt.Errorf("invalid block. Bits must be '%08x' not '%08x'", bits, b.Header.Bits)
+		}
+
+		if b.Header.Difficulty != 0 {
+			return fmt.Errorf("invalid block. `Difficulty` is replaced by `Bits` since TIP6 fork")
+		}
+
+		target, err = CompactToTarget(b.Header.Bits)
+		if err != nil {
+			return err
+		}
+	} else if b.Header.Bits != 0 {
+		return fmt.Errorf("invalid block. `Bits` can't be populated before TIP6 fork is active")
+	} else if rules.IsTIP5 {
+		if b.Header.Difficulty != difficulty {
+			return fmt.Errorf("invalid block. Difficulty must be '%d' not '%d'", difficulty, b.Header.Difficulty)
+		}
+	} else if b.Header.Difficulty != 0 {
+		return fmt.Errorf("invalid block. `Difficulty` can't be populated before TIP5 fork is active")
+	}
+
+	if !hash.MeetsPoW(&target, rules.IsTIP6) {
 		return fmt.Errorf("invalid block hash %x", hash)
 	}
 
-	err = applyTXs(b.Txs, s)
+	if rules.IsTIP9 {
+		if err := verifyMedianTimePast(b, s); err != nil {
+			return err
+		}
+	}
+
+	if rules.IsTIP10 {
+		if err := verifyBlockLimits(b, s.config); err != nil {
+			return err
+		}
+	}
+
+	if b.Header.BaseFee != rules.BaseFee {
+		if !rules.IsTIP11 {
+			return fmt.Errorf("invalid block. `BaseFee` can't be populated before TIP11 fork is active")
+		}
+
+		return fmt.Errorf("invalid block. Base fee must be '%d' not '%d'", rules.BaseFee, b.Header.BaseFee)
+	}
+
+	if rules.IsTIP2 {
+		if err := verifyTxRoot(b, rules); err != nil {
+			return err
+		}
+	} else if b.Header.TxRoot != nil {
+		return fmt.Errorf("invalid block. `TxRoot` can't be populated before TIP2 fork is active")
+	}
+
+	if rules.IsTIP3 && b.Header.StateRoot == nil {
+		return fmt.Errorf("invalid block. `StateRoot` is required since TIP3 fork")
+	}
+	if !rules.IsTIP3 && b.Header.StateRoot != nil {
+		return fmt.Errorf("invalid block. `StateRoot` can't be populated before TIP3 fork is active")
+	}
+
+	rewards, err := applyBlockTXs(b, s)
 	if err != nil {
 		return err
 	}
 
-	s.Balances[b.Header.Miner] += BlockReward
-	if s.IsTIP1Fork() {
-		s.Balances[b.Header.Miner] += b.GasReward()
-	} else {
-		s.Balances[b.Header.Miner] += uint(len(b.Txs)) * TxFee
+	if rules.IsTIP3 {
+		if root := s.StateRoot(); root != *b.Header.StateRoot {
+			return fmt.Errorf("invalid block. State root is '%x' not '%x'", root, *b.Header.StateRoot)
+		}
+	}
+
+	s.miningDifficulty = difficulty
+	s.blockTimes = appendBlockTime(s.blockTimes, b.Header.Time)
+	s.immature = lockRewards(s.immature, rewards, s.config, b.Header.Number+1)
+
+	return nil
+}
+
+// applyBlockTXs applies the block TXs and pays the miner, or since TIP7 fork the beneficiaries of the reward TXs.
+// It returns the paid rewards, locked until the CoinbaseMaturity.
+func applyBlockTXs(b Block, s *State) ([]ImmatureReward, error) {
+	rules := s.Rules()
+
+	rewards, txs := splitRewardTxs(b.Txs)
+	if !rules.IsTIP7 && len(rewards) > 0 {
+		return nil, fmt.Errorf("invalid block. Reward TXs can't be populated before TIP7 fork is active")
+	}
+
+	err := applyTXs(txs, s)
+	if err != nil {
+		return nil, err
+	}
+
+	reward := minerReward(b, rules)
+
+	if !rules.IsTIP7 {
+		s.Balances[b.Header.Miner] += reward
+		s.accountChanged(b.Header.Miner)
+		return []ImmatureReward{{Number: b.Header.Number, Account: b.Header.Miner, Value: reward}}, nil
+	}
+
+	if err := verifyRewardTxs(b, rewards, reward); err != nil {
+		return nil, err
+	}
+
+	paid := make([]ImmatureReward, 0, len(rewards))
+	for _, tx := range rewards {
+		s.Balances[tx.To] += tx.Value
+		s.accountChanged(tx.To)
+		paid = append(paid, ImmatureReward{Number: b.Header.Number, Account: tx.To, Value: tx.Value})
+	}
+
+	return paid, nil
+}
+
+// minerReward returns the block reward with the TX fees paid to the block miner, only their tips since TIP11 fork.
+func minerReward(b Block, rules Rules) uint {
+	if rules.IsTIP11 {
+		return rules.BlockReward + b.TipReward(rules.BaseFee)
+	}
+
+	if rules.IsTIP1 {
+		return rules.BlockReward + b.GasReward()
+	}
+
+	_, txs := splitRewardTxs(b.Txs)
+
+	return rules.BlockReward + uint(len(txs))*TxFee
+}
+
+// verifyTxRoot checks the block commits its TXs in the order they are applied.
+func verifyTxRoot(b Block, rules Rules) error {
+	if b.Header.TxRoot == nil {
+		return fmt.Errorf("invalid block. `TxRoot` is required since TIP2 fork")
+	}
+
+	// Reordering the TXs would break the commitment, they must be already sorted. Since TIP8 the block order rules.
+	if !rules.IsTIP8 {
+		_, txs := splitRewardTxs(b.Txs)
+		isSorted := sort.SliceIsSorted(txs, func(i, j int) bool {
+			return txs[i].Time < txs[j].Time
+		})
+		if !isSorted {
+			return fmt.Errorf("invalid block. TXs must be sorted by time since TIP2 fork")
+		}
+	}
+
+	root, err := TxsMerkleRoot(b.Txs)
+	if err != nil {
+		return err
+	}
+
+	if root != *b.Header.TxRoot {
+		return fmt.Errorf("invalid block. TXs Merkle root is '%x' not '%x'", root, *b.Header.TxRoot)
 	}
 
 	return nil
 }
 
+// applyTXs applies the TXs in the block order, sorted by time before TIP2 and TIP8 forks. The given slice is never reordered.
 func applyTXs(txs []SignedTx, s *State) error {
-	sort.Slice(txs, func(i, j int) bool {
-		return txs[i].Time < txs[j].Time
-	})
+	if rules := s.Rules(); !rules.IsTIP8 && !rules.IsTIP2 {
+		sorted := make([]SignedTx, len(txs))
+		copy(sorted, txs)
+
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i].Time < sorted[j].Time
+		})
+		txs = sorted
+	}
 
 	for _, tx := range txs {
 		if err := ApplyTx(tx, s); err != nil {
@@ -275,11 +618,14 @@ func ApplyTx(tx SignedTx, s *State) error {
 		return err
 	}
 
-	s.Balances[tx.From] -= tx.Cost(s.IsTIP1Fork())
+	s.Balances[tx.From] -= txCost(tx, s.Rules())
 	s.Balances[tx.To] += tx.Value
 
 	s.Account2Nonce[tx.From] = tx.Nonce
 
+	s.accountChanged(tx.From)
+	s.accountChanged(tx.To)
+
 	return nil
 }
 
@@ -293,32 +639,64 @@ func ValidateTx(tx SignedTx, s *State) error {
 		return fmt.Errorf("wrong TX. Sender '%s' is forged", tx.From.String())
 	}
 
+	rules := s.Rules()
+
+	if rules.IsTIP4 {
+		if tx.ChainID != rules.ChainID {
+			return fmt.Errorf("wrong TX. Chain ID must be '%d', not '%d'", rules.ChainID, tx.ChainID)
+		}
+	} else if tx.ChainID != 0 {
+		return fmt.Errorf("invalid TX. `ChainID` can't be populated before TIP4 fork is active")
+	}
+
 	expectedNonce := s.GetNextAccountNonce(tx.From)
 	if tx.Nonce != expectedNonce {
 		return fmt.Errorf("wrong TX. Sender '%s' next nonce must be '%d', not '%d'", tx.From.String(), expectedNonce, tx.Nonce)
 	}
 
-	if s.IsTIP1Fork() {
+	if rules.IsTIP1 {
 		// For now we only have one type, transfer TXs, so all TXs must pay 21 gas like on Ethereum (21 000)
 		if tx.Gas != TxGas {
 			return fmt.Errorf("insufficient TX gas %v. required: %v", tx.Gas, TxGas)
 		}
 
-		if tx.GasPrice < TxGasPriceDefault {
-			return fmt.Errorf("insufficient TX gasPrice %v. required at least: %v", tx.GasPrice, TxGasPriceDefault)
+		if rules.IsTIP11 {
+			if tx.GasPrice != 0 {
+				return fmt.Errorf("invalid TX. `GasPrice` is replaced by `MaxFee` and `Tip` since TIP11 fork")
+			}
+
+			if tx.MaxFee < rules.BaseFee {
+				return fmt.Errorf("insufficient TX maxFee %v. required at least the base fee: %v", tx.MaxFee, rules.BaseFee)
+			}
+
+			if tx.Tip > tx.MaxFee {
+				return fmt.Errorf("invalid TX. tip %v can't exceed the maxFee %v", tx.Tip, tx.MaxFee)
+			}
+		} else {
+			if tx.MaxFee != 0 || tx.Tip != 0 {
+				return fmt.Errorf("invalid TX. `MaxFee` and `Tip` can't be populated before TIP11 fork is active")
+			}
+
+			if tx.GasPrice < TxGasPriceDefault {
+				return fmt.Errorf("insufficient TX gasPrice %v. required at least: %v", tx.GasPrice, TxGasPriceDefault)
+			}
 		}
 
 	} else {
 		// Prior to TIP1, a signed TX must NOT populate the Gas fields to prevent consensus from crashing
 		// It's not enough to add this validation to http_routes.go because a TX could come from another node
 		// that could modify its software and broadcast such a TX, it must be validated here too.
-		if tx.Gas != 0 || tx.GasPrice != 0 {
-			return fmt.Errorf("invalid TX. `Gas` and `GasPrice` can't be populated before TIP1 fork is active")
+		if tx.Gas != 0 || tx.GasPrice != 0 || tx.MaxFee != 0 || tx.Tip != 0 {
+			return fmt.Errorf("invalid TX. `Gas`, `GasPrice`, `MaxFee` and `Tip` can't be populated before TIP1 fork is active")
 		}
 	}
 
-	if tx.Cost(s.IsTIP1Fork()) > s.Balances[tx.From] {
-		return fmt.Errorf("wrong TX. Sender '%s' balance is %d GC. Tx cost is %d GC", tx.From.String(), s.Balances[tx.From], tx.Cost(s.IsTIP1Fork()))
+	if cost := txCost(tx, rules); cost > s.SpendableBalance(tx.From) {
+		if immature := s.ImmatureBalance(tx.From); immature > 0 {
+			return fmt.Errorf("wrong TX. Sender '%s' spendable balance is %d GC, %d GC more are immature rewards. Tx cost is %d GC", tx.From.String(), s.SpendableBalance(tx.From), immature, cost)
+		}
+
+		return fmt.Errorf("wrong TX. Sender '%s' balance is %d GC. Tx cost is %d GC", tx.From.String(), s.Balances[tx.From], cost)
 	}
 
 	return nil
@@ -0,0 +1,490 @@
+package database
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var errStopReplay = errors.New("stop replay")
+
+// accountKeyBits is the depth of the State tree, the number of bits of an account key.
+const accountKeyBits = 8 * len(Hash{})
+
+// AccountLeaf is an account stored in the State tree, keyed by the SHA-256 of its address.
+type AccountLeaf struct {
+	Key     Hash `json:"key"`
+	Balance uint `json:"balance"`
+	Nonce   uint `json:"nonce"`
+}
+
+// AccountProof proves the account balance and nonce after a block, verifiable with VerifyAccountProof against
+// the block header.
+//
+// The State tree is a sparse Merkle tree over the account keys, where a subtree holding a single account is
+// replaced by its leaf. An account missing from the tree is proven by the empty subtree or a different
+// leaf found on its path.
+type AccountProof struct {
+	Account   common.Address `json:"account"`
+	Balance   uint           `json:"balance"`
+	Nonce     uint           `json:"nonce"`
+	BlockHash Hash           `json:"block_hash"`
+	Header    BlockHeader    `json:"header"`
+
+	// Siblings of the account path, from the root down
+	Siblings []Hash       `json:"siblings"`
+	Leaf     *AccountLeaf `json:"leaf,omitempty"`
+}
+
+// accountsTree is the State tree kept between blocks. The subtree hashes are cached and only the paths
+// of the accounts changed since the previous StateRoot are rehashed.
+type accountsTree struct {
+	root    *accountsNode
+	changed map[common.Address]struct{}
+}
+
+// accountsNode is a subtree of the State tree, a leaf when it holds a single account, nil when empty.
+//
+// Nodes are never modified once built, an update copies the path from the root, so State copies share them.
+type accountsNode struct {
+	hash  Hash
+	leaf  *AccountLeaf
+	left  *accountsNode
+	right *accountsNode
+}
+
+// StateRoot returns the root of the State tree over the account balances and nonces.
+func (s *State) StateRoot() Hash {
+	return s.accountsRoot().subtreeHash()
+}
+
+// accountsRoot returns the State tree, built from every account the first time and updated with the accounts
+// changed since afterwards.
+func (s *State) accountsRoot() *accountsNode {
+	if s.accounts == nil {
+		s.accounts = &accountsTree{
+			root:    buildAccountsNode(s.accountLeaves(), 0),
+			changed: make(map[common.Address]struct{}),
+		}
+
+		return s.accounts.root
+	}
+
+	for account := range s.accounts.changed {
+		balance, hasBalance := s.Balances[account]
+		nonce, hasNonce := s.Account2Nonce[account]
+
+		if hasBalance || hasNonce {
+			s.accounts.root = s.accounts.root.set(AccountLeaf{Key: accountKey(account), Balance: balance, Nonce: nonce}, 0)
+		} else {
+			s.accounts.root = s.accounts.root.remove(accountKey(account), 0)
+		}
+	}
+	s.accounts.changed = make(map[common.Address]struct{})
+
+	return s.accounts.root
+}
+
+// accountChanged marks the account to be updated in the State tree by the next StateRoot.
+func (s *State) accountChanged(account common.Address) {
+	if s.accounts != nil {
+		s.accounts.changed[account] = struct{}{}
+	}
+}
+
+func (t *accountsTree) copy() *accountsTree {
+	c := &accountsTree{root: t.root, changed: make(map[common.Address]struct{}, len(t.changed))}
+
+	for account := range t.changed {
+		c.changed[account] = struct{}{}
+	}
+
+	return c
+}
+
+// StateRootAfter returns the State root once the block TXs and rewards are applied, leaving the State untouched.
+// The block header, including its PoW, is not verified.
+func (s *State) StateRootAfter(b Block) (Hash, error) {
+	pendingState := s.Copy()
+
+	if _, err := applyBlockTXs(b, &pendingState); err != nil {
+		return Hash{}, err
+	}
+
+	return pendingState.StateRoot(), nil
+}
+
+// GetAccountProof proves the account balance and nonce after the main chain block at the given height.
+func GetAccountProof(state *State, account common.Address, height uint64) (AccountProof, error) {
+	past, err := state.stateAt(height)
+	if err != nil {
+		return AccountProof{}, err
+	}
+
+	proof := AccountProof{
+		Account:   account,
+		Balance:   past.Balances[account],
+		Nonce:     past.Account2Nonce[account],
+		BlockHash: past.latestBlockHash,
+		Header:    past.latestBlock.Header,
+		Siblings:  make([]Hash, 0),
+	}
+
+	if proof.Header.StateRoot == nil {
+		return proof, fmt.Errorf("block %d was mined before TIP3 fork and doesn't commit the State root", height)
+	}
+
+	key := accountKey(account)
+	node := past.accountsRoot()
+
+	for depth := 0; node != nil && node.leaf == nil; depth++ {
+		if keyBit(key, depth) == 0 {
+			proof.Siblings = append(proof.Siblings, node.right.subtreeHash())
+			node = node.left
+		} else {
+			proof.Siblings = append(proof.Siblings, node.left.subtreeHash())
+			node = node.right
+		}
+	}
+
+	if node != nil {
+		leaf := *node.leaf
+		proof.Leaf = &leaf
+	}
+
+	return proof, nil
+}
+
+// VerifyAccountProof checks the proven account balance and nonce lead to the State root committed in the block header.
+func VerifyAccountProof(header BlockHeader, proof AccountProof) error {
+	if header.StateRoot == nil {
+		return fmt.Errorf("block %d doesn't commit a State root", header.Number)
+	}
+
+	if len(proof.Siblings) > accountKeyBits {
+		return fmt.Errorf("account '%s' proof has %d siblings, the State tree is only %d deep", proof.Account.Hex(), len(proof.Siblings), accountKeyBits)
+	}
+
+	key := accountKey(proof.Account)
+	depth := len(proof.Siblings)
+
+	var node Hash
+
+	if proof.Leaf != nil && proof.Leaf.Key == key {
+		if proof.Leaf.Balance != proof.Balance || proof.Leaf.Nonce != proof.Nonce {
+			return fmt.Errorf("proven account values don't match the State tree leaf")
+		}
+		node = hashAccountLeaf(*proof.Leaf)
+	} else {
+		if proof.Balance != 0 || proof.Nonce != 0 {
+			return fmt.Errorf("account '%s' is not in the State tree, its balance and nonce must be 0", proof.Account.Hex())
+		}
+
+		if proof.Leaf != nil {
+			if !hasKeyPrefix(proof.Leaf.Key, key, depth) {
+				return fmt.Errorf("State tree leaf '%x' is not on the account path", proof.Leaf.Key)
+			}
+			node = hashAccountLeaf(*proof.Leaf)
+		}
+	}
+
+	for d := depth - 1; d >= 0; d-- {
+		if keyBit(key, d) == 0 {
+			node = hashAccountsNode(node, proof.Siblings[d])
+		} else {
+			node = hashAccountsNode(proof.Siblings[d], node)
+		}
+	}
+
+	if node != *header.StateRoot {
+		return fmt.Errorf("account '%s' proof leads to '%x' instead of '%x'", proof.Account.Hex(), node, *header.StateRoot)
+	}
+
+	return nil
+}
+
+// stateAt returns the State after the main chain block at the given height, rolled back from the latest block
+// if it's one of the recent main chain blocks. Older heights are rebuilt from the closest snapshot below them,
+// moved forward by the accountsDiff of the blocks since or, if the diffs are missing, by replaying the blocks.
+//
+// The returned State shares the BlockStore and must not be closed. Rebuilt from the diffs, it serves the accounts
+// and supply queries only, without the difficulty and block times the next block is validated with.
+func (s *State) stateAt(height uint64) (*State, error) {
+	if !s.hasGenesisBlock || height > s.latestBlock.Header.Number {
+		return nil, fmt.Errorf("invalid height: '%v'", height)
+	}
+
+	if height == s.latestBlock.Header.Number {
+		c := s.Copy()
+		return &c, nil
+	}
+
+	if back := s.latestBlock.Header.Number - height; back < uint64(len(s.mainChain)) {
+		past := s.rollback(len(s.mainChain) - 1 - int(back))
+		return &past, nil
+	}
+
+	past, err := newStateFromGenesis(s.dataDir, s.initialDifficulty(), s.store)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, blockFs, err := past.latestSnapshot(func(snapshot Snapshot) bool {
+		return snapshot.Height <= height
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if snapshot != nil {
+		past.restoreSnapshot(*snapshot, blockFs)
+
+		if snapshot.Height == height {
+			return past, nil
+		}
+	}
+
+	applied, err := past.applyAccountsDiffs(s.txIndex, height)
+	if err != nil {
+		return nil, err
+	}
+
+	if applied {
+		return past, nil
+	}
+
+	err = past.replay(past.NextBlockNumber(), func(blockFs BlockFS) error {
+		if blockFs.Value.Header.Number == height {
+			return errStopReplay
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return past, nil
+}
+
+// applyAccountsDiffs moves the State forward to after the main chain block at the height with the accountsDiff
+// of the blocks since its latest block. It returns false, leaving the State untouched, if a diff is missing.
+func (s *State) applyAccountsDiffs(index *TxIndex, height uint64) (bool, error) {
+	if index == nil {
+		return false, nil
+	}
+
+	diffs := make([]accountsDiff, 0, height+1-s.NextBlockNumber())
+
+	for number := s.NextBlockNumber(); number <= height; number++ {
+		diff, err := index.accountsDiff(number)
+		if errors.Is(err, errAccountsDiffNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		diffs = append(diffs, diff)
+	}
+
+	blockFs, err := s.store.BlockByHeight(height)
+	if err != nil {
+		return false, err
+	}
+
+	if blockFs.Key != diffs[len(diffs)-1].BlockHash {
+		return false, nil
+	}
+
+	for _, diff := range diffs {
+		diff.apply(s)
+	}
+
+	s.latestBlock = blockFs.Value
+	s.latestBlockHash = blockFs.Key
+	s.hasGenesisBlock = true
+	s.baseFee = s.NextBaseFee()
+
+	return true, nil
+}
+
+// accountLeaves returns every account with a balance or nonce entry, sorted by key.
+func (s *State) accountLeaves() []AccountLeaf {
+	leaves := make([]AccountLeaf, 0, len(s.Balances))
+	seen := make(map[common.Address]struct{})
+
+	add := func(account common.Address) {
+		if _, ok := seen[account]; ok {
+			return
+		}
+		seen[account] = struct{}{}
+
+		leaves = append(leaves, AccountLeaf{
+			Key:     accountKey(account),
+			Balance: s.Balances[account],
+			Nonce:   s.Account2Nonce[account],
+		})
+	}
+
+	for account := range s.Balances {
+		add(account)
+	}
+
+	for account := range s.Account2Nonce {
+		add(account)
+	}
+
+	sort.Slice(leaves, func(i, j int) bool {
+		return bytes.Compare(leaves[i].Key[:], leaves[j].Key[:]) < 0
+	})
+
+	return leaves
+}
+
+// buildAccountsNode builds the subtree at the depth holding the sorted leaves, which must share the path to it.
+func buildAccountsNode(leaves []AccountLeaf, depth int) *accountsNode {
+	switch len(leaves) {
+	case 0:
+		return nil
+	case 1:
+		return newAccountsLeafNode(leaves[0])
+	}
+
+	left, right := splitAccountLeaves(leaves, depth)
+
+	return newAccountsInnerNode(buildAccountsNode(left, depth+1), buildAccountsNode(right, depth+1))
+}
+
+func newAccountsLeafNode(leaf AccountLeaf) *accountsNode {
+	return &accountsNode{hash: hashAccountLeaf(leaf), leaf: &leaf}
+}
+
+func newAccountsInnerNode(left, right *accountsNode) *accountsNode {
+	return &accountsNode{hash: hashAccountsNode(left.subtreeHash(), right.subtreeHash()), left: left, right: right}
+}
+
+func (n *accountsNode) subtreeHash() Hash {
+	if n == nil {
+		return Hash{}
+	}
+
+	return n.hash
+}
+
+// set returns the subtree at the depth with the leaf added or replaced, rehashing its path only.
+func (n *accountsNode) set(leaf AccountLeaf, depth int) *accountsNode {
+	if n == nil {
+		return newAccountsLeafNode(leaf)
+	}
+
+	if n.leaf != nil {
+		if *n.leaf == leaf {
+			return n
+		}
+
+		if n.leaf.Key == leaf.Key {
+			return newAccountsLeafNode(leaf)
+		}
+
+		leaves := []AccountLeaf{*n.leaf, leaf}
+		if bytes.Compare(leaf.Key[:], n.leaf.Key[:]) < 0 {
+			leaves[0], leaves[1] = leaf, *n.leaf
+		}
+
+		return buildAccountsNode(leaves, depth)
+	}
+
+	if keyBit(leaf.Key, depth) == 0 {
+		return newAccountsInnerNode(n.left.set(leaf, depth+1), n.right)
+	}
+
+	return newAccountsInnerNode(n.left, n.right.set(leaf, depth+1))
+}
+
+// remove returns the subtree at the depth without the leaf of the key, rehashing its path only.
+func (n *accountsNode) remove(key Hash, depth int) *accountsNode {
+	if n == nil {
+		return nil
+	}
+
+	if n.leaf != nil {
+		if n.leaf.Key == key {
+			return nil
+		}
+
+		return n
+	}
+
+	left, right := n.left, n.right
+	if keyBit(key, depth) == 0 {
+		left = left.remove(key, depth+1)
+	} else {
+		right = right.remove(key, depth+1)
+	}
+
+	if left == n.left && right == n.right {
+		return n
+	}
+
+	// A subtree left with a single account is replaced by its leaf
+	if left == nil && (right == nil || right.leaf != nil) {
+		return right
+	}
+
+	if right == nil && left.leaf != nil {
+		return left
+	}
+
+	return newAccountsInnerNode(left, right)
+}
+
+// splitAccountLeaves splits the sorted leaves by their key bit at the depth.
+func splitAccountLeaves(leaves []AccountLeaf, depth int) ([]AccountLeaf, []AccountLeaf) {
+	i := sort.Search(len(leaves), func(i int) bool {
+		return keyBit(leaves[i].Key, depth) == 1
+	})
+
+	return leaves[:i], leaves[i:]
+}
+
+func accountKey(account common.Address) Hash {
+	return sha256.Sum256(account.Bytes())
+}
+
+func keyBit(key Hash, depth int) byte {
+	return (key[depth/8] >> (7 - uint(depth%8))) & 1
+}
+
+func hasKeyPrefix(key, prefix Hash, depth int) bool {
+	for d := 0; d < depth; d++ {
+		if keyBit(key, d) != keyBit(prefix, d) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hashAccountLeaf(leaf AccountLeaf) Hash {
+	data := make([]byte, 0, 1+len(leaf.Key)+16)
+	data = append(data, 0)
+	data = append(data, leaf.Key[:]...)
+	data = append(data, encodeUint64(uint64(leaf.Balance))...)
+	data = append(data, encodeUint64(uint64(leaf.Nonce))...)
+
+	return sha256.Sum256(data)
+}
+
+func hashAccountsNode(left, right Hash) Hash {
+	data := make([]byte, 0, 1+2*len(left))
+	data = append(data, 1)
+	data = append(data, left[:]...)
+	data = append(data, right[:]...)
+
+	return sha256.Sum256(data)
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestState_AccountProof(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+	unknown := NewAccount("0x00000000000000000000000000000000000000cc")
+
+	forkTIP3 := uint64(1)
+	dataDir := setupTestDataDirWithGenesis(t, Genesis{Balances: map[common.Address]uint{sender: 1000}, ForkTIP3: &forkTIP3})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+	state.snapshotInterval = 2
+
+	parent := addTestBlock(t, state, mineTestBlock(t, Hash{}, 0, miner, nil))
+
+	if _, err := state.AddBlock(mineTestBlock(t, parent, 1, miner, nil)); err == nil {
+		t.Fatal("block without State root must be rejected since TIP3")
+	}
+
+	wrongRoot := Hash{1}
+	wrong := NewBlock(parent, 1, 0, 1650000001, miner, nil)
+	wrong.Header.StateRoot = &wrongRoot
+	if _, err := state.AddBlock(mineTestPreparedBlock(t, wrong)); err == nil {
+		t.Fatal("block with a wrong State root must be rejected")
+	}
+
+	balances := make(map[uint64]uint)
+
+	for i := uint64(1); i <= 5; i++ {
+		tx := signTestTx(t, NewBaseTx(sender, receiver, uint(i), uint(i), ""), key)
+		b := NewBlock(parent, i, 0, 1650000000+i, miner, []SignedTx{tx})
+
+		root, err := state.StateRootAfter(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Header.StateRoot = &root
+
+		parent = addTestBlock(t, state, mineTestPreparedBlock(t, b))
+		balances[i] = state.Balances[receiver]
+	}
+
+	for _, height := range []uint64{1, 3, 5} {
+		for _, account := range []common.Address{sender, receiver, miner, unknown} {
+			proof, err := GetAccountProof(state, account, height)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if proof.Header.Number != height {
+				t.Fatalf("proof must be against block %d, got %d", height, proof.Header.Number)
+			}
+
+			if err := VerifyAccountProof(proof.Header, proof); err != nil {
+				t.Fatalf("account '%s' at height %d must be proven: %s", account.Hex(), height, err)
+			}
+
+			if account == receiver && proof.Balance != balances[height] {
+				t.Fatalf("receiver balance at height %d must be %d, got %d", height, balances[height], proof.Balance)
+			}
+
+			proof.Balance++
+			if err := VerifyAccountProof(proof.Header, proof); err == nil {
+				t.Fatalf("tampered balance of '%s' at height %d must be rejected", account.Hex(), height)
+			}
+		}
+	}
+}
+
+func TestVerifyAccountProof_TooDeep(t *testing.T) {
+	root := Hash{}
+	header := BlockHeader{Number: 1, StateRoot: &root}
+
+	proof := AccountProof{
+		Account:  NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8"),
+		Siblings: make([]Hash, accountKeyBits+1),
+		Leaf:     &AccountLeaf{},
+	}
+
+	if err := VerifyAccountProof(header, proof); err == nil {
+		t.Fatal("proof deeper than the State tree must be rejected")
+	}
+}
+
+func TestState_StateRootUpdate(t *testing.T) {
+	state := State{Balances: make(map[common.Address]uint), Account2Nonce: make(map[common.Address]uint)}
+	accounts := make([]common.Address, 0)
+
+	for i := 0; i < 20; i++ {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		accounts = append(accounts, crypto.PubkeyToAddress(key.PublicKey))
+	}
+
+	if state.StateRoot() != (Hash{}) {
+		t.Fatal("State root without accounts must be the empty hash")
+	}
+
+	before := state.Copy()
+	for i, account := range accounts {
+		state.Balances[account] = uint(i)
+		state.accountChanged(account)
+	}
+	state.Account2Nonce[accounts[3]] = 1
+	state.accountChanged(accounts[3])
+
+	expectStateRoot := func(state *State) {
+		t.Helper()
+
+		if root, rebuilt := state.StateRoot(), buildAccountsNode(state.accountLeaves(), 0).subtreeHash(); root != rebuilt {
+			t.Fatalf("updated State root '%x' must be the rebuilt one '%x'", root, rebuilt)
+		}
+	}
+	expectStateRoot(&state)
+
+	// Removing all but one account collapses the tree back to its leaf
+	undo := newAccountsUndo(&before, &state)
+	after := state.Copy()
+	state.Balances[accounts[0]] = 0
+	state.accountChanged(accounts[0])
+	for i, account := range undo.newBalances {
+		if account == accounts[0] {
+			undo.newBalances = append(undo.newBalances[:i], undo.newBalances[i+1:]...)
+			break
+		}
+	}
+	undo.revert(&state)
+	expectStateRoot(&state)
+
+	if root := state.StateRoot(); root != hashAccountLeaf(AccountLeaf{Key: accountKey(accounts[0])}) {
+		t.Fatalf("State root of a single account must be its leaf, got '%x'", root)
+	}
+
+	// The copy taken before is not affected by the changes since
+	expectStateRoot(&after)
+}
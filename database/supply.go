@@ -0,0 +1,125 @@
+package database
+
+// Supply accounts for all the coins of the chain after a main chain block.
+type Supply struct {
+	BlockHash Hash   `json:"block_hash"`
+	Height    uint64 `json:"block_height"`
+
+	Genesis     uint `json:"genesis_supply"`
+	Minted      uint `json:"minted_rewards"`
+	Burned      uint `json:"burned_fees"`
+	Circulating uint `json:"circulating_supply"`
+
+	// MaxSupply is 0 if the supply is unlimited
+	MaxSupply uint `json:"max_supply"`
+}
+
+// Reward returns the block reward minted by the block at the given height.
+//
+// The BlockReward halves every HalvingInterval blocks down to the TailEmission,
+// and stops once the MaxSupply is reached.
+func (c ChainConfig) Reward(number uint64) uint {
+	if c.MaxSupply == 0 {
+		return c.scheduledReward(number)
+	}
+
+	return c.Minted(number+1) - c.Minted(number)
+}
+
+// Minted returns the sum of the block rewards minted by all the blocks before the given height.
+func (c ChainConfig) Minted(number uint64) uint {
+	minted := c.scheduledRewards(number)
+
+	if c.MaxSupply != 0 && minted > c.MaxSupply-c.GenesisSupply {
+		return c.MaxSupply - c.GenesisSupply
+	}
+
+	return minted
+}
+
+// scheduledReward returns the block reward following the halvings, regardless of the MaxSupply.
+func (c ChainConfig) scheduledReward(number uint64) uint {
+	reward := c.BlockReward
+
+	if c.HalvingInterval != 0 {
+		if halvings := number / c.HalvingInterval; halvings < 64 {
+			reward >>= halvings
+		} else {
+			reward = 0
+		}
+	}
+
+	if reward < c.TailEmission {
+		return c.TailEmission
+	}
+
+	return reward
+}
+
+// scheduledRewards sums the scheduledReward of the blocks before the given height, a halving interval at a time.
+func (c ChainConfig) scheduledRewards(number uint64) uint {
+	if c.HalvingInterval == 0 {
+		return uint(number) * c.BlockReward
+	}
+
+	total := uint(0)
+
+	for start := uint64(0); start < number; start += c.HalvingInterval {
+		reward := c.scheduledReward(start)
+
+		// The reward doesn't change anymore once it reaches the tail emission
+		if reward == c.TailEmission {
+			return total + uint(number-start)*reward
+		}
+
+		end := start + c.HalvingInterval
+		if end > number || end < start {
+			end = number
+		}
+
+		total += uint(end-start) * reward
+
+		if end == number {
+			break
+		}
+	}
+
+	return total
+}
+
+// Supply returns the supply after the latest block.
+func (s *State) Supply() Supply {
+	return s.supply()
+}
+
+// SupplyAt returns the supply after the main chain block at the given height.
+func (s *State) SupplyAt(height uint64) (Supply, error) {
+	past, err := s.stateAt(height)
+	if err != nil {
+		return Supply{}, err
+	}
+
+	return past.supply(), nil
+}
+
+// supply counts the coins of the State. Every coin is either premined or minted by a block reward,
+// the ones missing from the balances were burned.
+func (s *State) supply() Supply {
+	supply := Supply{
+		BlockHash: s.latestBlockHash,
+		Height:    s.latestBlock.Header.Number,
+		Genesis:   s.config.GenesisSupply,
+		Minted:    s.config.Minted(s.NextBlockNumber()),
+		MaxSupply: s.config.MaxSupply,
+	}
+
+	for _, balance := range s.Balances {
+		supply.Circulating += balance
+	}
+
+	if issued := supply.Genesis + supply.Minted; issued > supply.Circulating {
+		supply.Burned = issued - supply.Circulating
+	}
+
+	return supply
+}
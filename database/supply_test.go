@@ -0,0 +1,99 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestChainConfig_Reward(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ChainConfig
+		rewards []uint
+	}{
+		{
+			name:    "constant",
+			config:  ChainConfig{BlockReward: 100},
+			rewards: []uint{100, 100, 100, 100},
+		},
+		{
+			name:    "halvings",
+			config:  ChainConfig{BlockReward: 100, HalvingInterval: 2},
+			rewards: []uint{100, 100, 50, 50, 25, 25, 12, 12, 6, 6, 3, 3, 1, 1, 0, 0},
+		},
+		{
+			name:    "tail emission",
+			config:  ChainConfig{BlockReward: 100, HalvingInterval: 2, TailEmission: 10},
+			rewards: []uint{100, 100, 50, 50, 25, 25, 12, 12, 10, 10, 10, 10},
+		},
+		{
+			name:    "max supply",
+			config:  ChainConfig{BlockReward: 100, MaxSupply: 1230, GenesisSupply: 1000},
+			rewards: []uint{100, 100, 30, 0, 0},
+		},
+	}
+
+	for _, tc := range tests {
+		minted := uint(0)
+
+		for number, expected := range tc.rewards {
+			if reward := tc.config.Reward(uint64(number)); reward != expected {
+				t.Errorf("%s: block %d reward must be %d, got %d", tc.name, number, expected, reward)
+			}
+
+			minted += expected
+
+			if got := tc.config.Minted(uint64(number + 1)); got != minted {
+				t.Errorf("%s: minted before block %d must be %d, got %d", tc.name, number+1, minted, got)
+			}
+		}
+	}
+}
+
+func TestState_Supply(t *testing.T) {
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+
+	dataDir := setupTestDataDirWithGenesis(t, Genesis{
+		Balances:        map[common.Address]uint{miner: 1000},
+		HalvingInterval: 2,
+	})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	parent := Hash{}
+	for number := uint64(0); number < 3; number++ {
+		parent = addTestBlock(t, state, mineTestBlock(t, parent, number, miner, nil))
+	}
+
+	if balance := state.Balances[miner]; balance != 1000+2*BlockReward+BlockReward/2 {
+		t.Fatalf("miner balance must include the halved reward, got %d", balance)
+	}
+
+	supply := state.Supply()
+	expected := Supply{
+		BlockHash:   parent,
+		Height:      2,
+		Genesis:     1000,
+		Minted:      2*BlockReward + BlockReward/2,
+		Circulating: 1000 + 2*BlockReward + BlockReward/2,
+	}
+	if supply != expected {
+		t.Fatalf("supply must be %+v, got %+v", expected, supply)
+	}
+
+	past, err := state.SupplyAt(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if past.Minted != BlockReward || past.Circulating != 1000+BlockReward || past.Burned != 0 {
+		t.Fatalf("supply after the first block must have minted %d, got %+v", BlockReward, past)
+	}
+}
@@ -23,6 +23,14 @@ type Tx struct {
 	Nonce    uint           `json:"nonce"`
 	Data     string         `json:"data"`
 	Time     uint64         `json:"time"`
+
+	// ChainID binds the signature to a single chain since TIP4 fork, so the TX can't be replayed elsewhere
+	ChainID uint64 `json:"chainId,omitempty"`
+
+	// MaxFee is the highest price per gas the sender pays and Tip the part above the block base fee paid
+	// to the miner. They replace the GasPrice since TIP11 fork, see EffectiveGasPrice.
+	MaxFee uint `json:"maxFee,omitempty"`
+	Tip    uint `json:"tip,omitempty"`
 }
 
 type SignedTx struct {
@@ -54,8 +62,9 @@ func NewSignedTx(tx Tx, sig []byte) SignedTx {
 	}
 }
 
+// IsReward reports whether the TX mints a block reward, see NewRewardTx, rather than transfers an account's funds.
 func (t Tx) IsReward() bool {
-	return t.Data == "reward"
+	return t.Data == TxRewardData && t.From == common.Address{}
 }
 
 func (t Tx) Cost(isTip1Fork bool) uint {
@@ -70,6 +79,35 @@ func (t Tx) GasCost() uint {
 	return t.Gas * t.GasPrice
 }
 
+// EffectiveGasPrice returns the price per gas the TX pays in a block with the base fee: the base fee
+// with the tip, up to the max fee. TXs without a max fee pay their GasPrice.
+func (t Tx) EffectiveGasPrice(baseFee uint) uint {
+	if t.MaxFee == 0 {
+		return t.GasPrice
+	}
+
+	if baseFee+t.Tip > t.MaxFee {
+		return t.MaxFee
+	}
+
+	return baseFee + t.Tip
+}
+
+// FeeAt returns the fee the TX pays in a block with the base fee.
+func (t Tx) FeeAt(baseFee uint) uint {
+	return t.Gas * t.EffectiveGasPrice(baseFee)
+}
+
+// TipAt returns the part of the fee paid to the miner of a block with the base fee, the rest is burned.
+func (t Tx) TipAt(baseFee uint) uint {
+	price := t.EffectiveGasPrice(baseFee)
+	if price < baseFee {
+		return 0
+	}
+
+	return t.Gas * (price - baseFee)
+}
+
 func (t Tx) Encode() ([]byte, error) {
 	return json.Marshal(t)
 }
@@ -108,6 +146,9 @@ func (t Tx) MarshalJSON() ([]byte, error) {
 		Nonce    uint           `json:"nonce"`
 		Data     string         `json:"data"`
 		Time     uint64         `json:"time"`
+		ChainID  uint64         `json:"chainId,omitempty"`
+		MaxFee   uint           `json:"maxFee,omitempty"`
+		Tip      uint           `json:"tip,omitempty"`
 	}
 
 	return json.Marshal(tip1Tx{
@@ -119,6 +160,9 @@ func (t Tx) MarshalJSON() ([]byte, error) {
 		Nonce:    t.Nonce,
 		Data:     t.Data,
 		Time:     t.Time,
+		ChainID:  t.ChainID,
+		MaxFee:   t.MaxFee,
+		Tip:      t.Tip,
 	})
 }
 
@@ -158,6 +202,9 @@ func (t SignedTx) MarshalJSON() ([]byte, error) {
 		Nonce    uint           `json:"nonce"`
 		Data     string         `json:"data"`
 		Time     uint64         `json:"time"`
+		ChainID  uint64         `json:"chainId,omitempty"`
+		MaxFee   uint           `json:"maxFee,omitempty"`
+		Tip      uint           `json:"tip,omitempty"`
 		Sig      []byte         `json:"signature"`
 	}
 
@@ -170,6 +217,9 @@ func (t SignedTx) MarshalJSON() ([]byte, error) {
 		Nonce:    t.Nonce,
 		Data:     t.Data,
 		Time:     t.Time,
+		ChainID:  t.ChainID,
+		MaxFee:   t.MaxFee,
+		Tip:      t.Tip,
 		Sig:      t.Sig,
 	})
 }
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestValidateTx_ChainID(t *testing.T) {
+	senderKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(senderKey.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+
+	forkTIP4 := uint64(1)
+	dataDir := setupTestDataDirWithGenesis(t, Genesis{
+		ChainID:  7,
+		Balances: map[common.Address]uint{sender: 1000},
+		ForkTIP4: &forkTIP4,
+	})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	newTx := func(nonce uint, chainID uint64) SignedTx {
+		tx := NewBaseTx(sender, receiver, 10, nonce, "")
+		tx.ChainID = chainID
+
+		return signTestTx(t, tx, senderKey)
+	}
+
+	if err := ValidateTx(newTx(1, 7), state); err == nil {
+		t.Fatalf("TX with a chain ID must be rejected before TIP4")
+	}
+
+	b0Hash := addTestBlock(t, state, mineTestBlock(t, Hash{}, 0, miner, []SignedTx{newTx(1, 0)}))
+
+	if err := ValidateTx(newTx(2, 0), state); err == nil {
+		t.Fatalf("TX without a chain ID must be rejected since TIP4")
+	}
+
+	if err := ValidateTx(newTx(2, 8), state); err == nil {
+		t.Fatalf("TX signed for a different chain must be rejected")
+	}
+
+	// Changing the chain ID of a signed TX invalidates its signature
+	replayed := newTx(2, 8)
+	replayed.ChainID = 7
+	if err := ValidateTx(replayed, state); err == nil {
+		t.Fatalf("TX replayed from a different chain must be rejected")
+	}
+
+	addTestBlock(t, state, mineTestBlock(t, b0Hash, 1, miner, []SignedTx{newTx(2, 7)}))
+
+	if state.Account2Nonce[sender] != 2 {
+		t.Fatalf("TX signed for the chain must be applied")
+	}
+}
+
+func TestSignedTx_FeesAreSigned(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+
+	tx := signTestTx(t, Tx{From: sender, To: receiver, Gas: TxGas, MaxFee: 5, Tip: 2, Value: 10, Nonce: 1}, key)
+
+	for _, tamper := range []func(*SignedTx){
+		func(tx *SignedTx) { tx.MaxFee = 50 },
+		func(tx *SignedTx) { tx.Tip = 5 },
+	} {
+		tampered := tx
+		tamper(&tampered)
+
+		if ok, err := tampered.IsAuthentic(); err != nil || ok {
+			t.Fatalf("TX with a changed fee must not be authentic")
+		}
+	}
+
+	if ok, err := tx.IsAuthentic(); err != nil || !ok {
+		t.Fatalf("signed TX must be authentic")
+	}
+}
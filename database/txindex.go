@@ -0,0 +1,321 @@
+package database
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+var txIndexTxPrefix = []byte("t")
+var txIndexAddressPrefix = []byte("a")
+var txIndexDiffPrefix = []byte("d")
+var txIndexTipKey = []byte("head")
+var txIndexVersionKey = []byte("version")
+
+// txIndexVersion is bumped whenever the indexed data change, to rebuild the existing indexes.
+const txIndexVersion = 2
+
+var ErrTxNotFound = errors.New("tx not found")
+var errAccountsDiffNotFound = errors.New("accounts diff not found")
+
+// TxLocation is the position of a TX within the main chain.
+type TxLocation struct {
+	BlockHash Hash   `json:"block_hash"`
+	Height    uint64 `json:"block_height"`
+	Index     int    `json:"index"`
+}
+
+// TxIndex maps the hashes of the main chain TXs to their location and every address to its history.
+// It also keeps the accountsDiff of the main chain blocks indexed while the State was applying them.
+//
+// The index remembers the last indexed block, it's caught up with the BlockStore when opened and
+// rebuilt from scratch if that block is no longer part of the main chain.
+type TxIndex struct {
+	db     *leveldb.DB
+	config ChainConfig
+}
+
+func openTxIndex(dataDir string, store BlockStore, config ChainConfig) (*TxIndex, error) {
+	isNewIndex := !fileExists(getTxIndexDirPath(dataDir))
+
+	db, err := leveldb.OpenFile(getTxIndexDirPath(dataDir), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &TxIndex{db: db, config: config}
+
+	if isNewIndex {
+		fmt.Printf("Building the TX index...\n")
+	}
+
+	if err := index.catchUp(store); err != nil {
+		_ = index.Close()
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// Reindex rebuilds the block.db index, if the data dir uses the FileDBEngine, and the TX index.
+func Reindex(dataDir string) error {
+	if dataDirDBEngine(dataDir) == FileDBEngine {
+		if err := RebuildBlockIndex(dataDir); err != nil {
+			return err
+		}
+	}
+
+	if err := os.RemoveAll(getTxIndexDirPath(dataDir)); err != nil {
+		return err
+	}
+
+	gen, err := loadGenesis(getGenesisJsonFilePath(dataDir))
+	if err != nil {
+		return err
+	}
+
+	store, err := OpenBlockStore(dataDir, "")
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	config, err := gen.ChainConfig()
+	if err != nil {
+		return err
+	}
+
+	index, err := openTxIndex(dataDir, store, config)
+	if err != nil {
+		return err
+	}
+
+	return index.Close()
+}
+
+// Get returns the location of a main chain TX or ErrTxNotFound.
+func (ti *TxIndex) Get(txHash Hash) (TxLocation, error) {
+	value, err := ti.db.Get(txIndexKey(txHash), nil)
+	if err == leveldb.ErrNotFound {
+		return TxLocation{}, ErrTxNotFound
+	}
+	if err != nil {
+		return TxLocation{}, err
+	}
+
+	var location TxLocation
+	copy(location.BlockHash[:], value[:32])
+	location.Height = binary.BigEndian.Uint64(value[32:40])
+	location.Index = int(binary.BigEndian.Uint64(value[40:48]))
+
+	return location, nil
+}
+
+// indexBlock adds the TXs of the new main chain tip, the history entries of their addresses and the block
+// accountsDiff, if known.
+func (ti *TxIndex) indexBlock(hash Hash, b Block, diff *accountsDiff) error {
+	batch := new(leveldb.Batch)
+
+	for i, tx := range b.Txs {
+		txHash, err := tx.Hash()
+		if err != nil {
+			return err
+		}
+
+		value := make([]byte, 0, 48)
+		value = append(value, hash[:]...)
+		value = append(value, encodeUint64(b.Header.Number)...)
+		value = append(value, encodeUint64(uint64(i))...)
+
+		batch.Put(txIndexKey(txHash), value)
+	}
+
+	entries, err := addressTxs(hash, b, ti.config.BlockRules(b))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		entryJson, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		batch.Put(entry.key(), entryJson)
+	}
+
+	if diff != nil {
+		diffJson, err := json.Marshal(diff)
+		if err != nil {
+			return err
+		}
+
+		batch.Put(txIndexDiffKey(b.Header.Number), diffJson)
+	} else {
+		batch.Delete(txIndexDiffKey(b.Header.Number))
+	}
+
+	batch.Put(txIndexTipKey, append(encodeUint64(b.Header.Number), hash[:]...))
+
+	return ti.db.Write(batch, nil)
+}
+
+// accountsDiff returns the accountsDiff of the main chain block at the height, or errAccountsDiffNotFound.
+func (ti *TxIndex) accountsDiff(height uint64) (accountsDiff, error) {
+	value, err := ti.db.Get(txIndexDiffKey(height), nil)
+	if err == leveldb.ErrNotFound {
+		return accountsDiff{}, errAccountsDiffNotFound
+	}
+	if err != nil {
+		return accountsDiff{}, err
+	}
+
+	var diff accountsDiff
+	if err := json.Unmarshal(value, &diff); err != nil {
+		return accountsDiff{}, err
+	}
+
+	return diff, nil
+}
+
+// unindexBlocks removes the TXs of blocks detached from the main chain, moving the tip to their parent.
+func (ti *TxIndex) unindexBlocks(blocks []Block) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	batch := new(leveldb.Batch)
+
+	for _, b := range blocks {
+		for _, tx := range b.Txs {
+			txHash, err := tx.Hash()
+			if err != nil {
+				return err
+			}
+			batch.Delete(txIndexKey(txHash))
+		}
+
+		entries, err := addressTxs(Hash{}, b, ti.config.BlockRules(b))
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			batch.Delete(entry.key())
+		}
+
+		batch.Delete(txIndexDiffKey(b.Header.Number))
+	}
+
+	first := blocks[0].Header
+	if first.Number == 0 {
+		batch.Delete(txIndexTipKey)
+	} else {
+		batch.Put(txIndexTipKey, append(encodeUint64(first.Number-1), first.Parent[:]...))
+	}
+
+	return ti.db.Write(batch, nil)
+}
+
+// GetTx returns a main chain TX with its location, or ErrTxNotFound.
+func (s *State) GetTx(txHash Hash) (SignedTx, TxLocation, error) {
+	if s.txIndex == nil {
+		return SignedTx{}, TxLocation{}, fmt.Errorf("TX index is not open")
+	}
+
+	location, err := s.txIndex.Get(txHash)
+	if err != nil {
+		return SignedTx{}, location, err
+	}
+
+	blockFs, err := s.store.BlockByHash(location.BlockHash)
+	if err != nil {
+		return SignedTx{}, location, err
+	}
+
+	if location.Index >= len(blockFs.Value.Txs) {
+		return SignedTx{}, location, fmt.Errorf("TX index points to missing TX %d of block '%x', rebuild it with 'gc db reindex'", location.Index, location.BlockHash)
+	}
+
+	return blockFs.Value.Txs[location.Index], location, nil
+}
+
+func (ti *TxIndex) Close() error {
+	return ti.db.Close()
+}
+
+func (ti *TxIndex) catchUp(store BlockStore) error {
+	fromHeight := uint64(0)
+
+	version, err := ti.db.Get(txIndexVersionKey, nil)
+	if err != nil && err != leveldb.ErrNotFound {
+		return err
+	}
+
+	if err == nil && binary.BigEndian.Uint64(version) == txIndexVersion {
+		value, err := ti.db.Get(txIndexTipKey, nil)
+		if err != nil && err != leveldb.ErrNotFound {
+			return err
+		}
+
+		if err == nil {
+			var tipHash Hash
+			tipHeight := binary.BigEndian.Uint64(value[:8])
+			copy(tipHash[:], value[8:])
+
+			tip, err := store.BlockByHeight(tipHeight)
+			if err == nil && tip.Key == tipHash {
+				fromHeight = tipHeight + 1
+			} else {
+				fmt.Printf("Indexed TXs tip '%x' is not part of the main chain anymore, rebuilding the TX index...\n", tipHash)
+			}
+		}
+	} else if err == nil {
+		fmt.Printf("TX index is outdated, rebuilding it...\n")
+	}
+
+	if fromHeight == 0 {
+		if err := ti.clear(); err != nil {
+			return err
+		}
+	}
+
+	return store.Iterate(fromHeight, func(blockFs BlockFS) error {
+		return ti.indexBlock(blockFs.Key, blockFs.Value, nil)
+	})
+}
+
+// clear removes all the indexed data, leaving an empty index of the current version.
+func (ti *TxIndex) clear() error {
+	batch := new(leveldb.Batch)
+
+	iter := ti.db.NewIterator(nil, nil)
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	batch.Put(txIndexVersionKey, encodeUint64(txIndexVersion))
+
+	return ti.db.Write(batch, nil)
+}
+
+func txIndexKey(txHash Hash) []byte {
+	return append(append([]byte{}, txIndexTxPrefix...), txHash[:]...)
+}
+
+func txIndexDiffKey(height uint64) []byte {
+	return append(append([]byte{}, txIndexDiffPrefix...), encodeUint64(height)...)
+}
+
+func getTxIndexDirPath(dataDir string) string {
+	return filepath.Join(getDatabaseDirPath(dataDir), "txindex")
+}
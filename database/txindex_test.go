@@ -0,0 +1,99 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestState_TxIndex(t *testing.T) {
+	senderKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(senderKey.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	minerA := NewAccount("0x00000000000000000000000000000000000000aa")
+	minerB := NewAccount("0x00000000000000000000000000000000000000bb")
+
+	dataDir := setupTestDataDir(t, map[common.Address]uint{sender: 1000})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txA := signTestTx(t, NewBaseTx(sender, receiver, 10, 1, ""), senderKey)
+	txB := signTestTx(t, NewBaseTx(sender, receiver, 20, 1, "branch"), senderKey)
+
+	txAHash, err := txA.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txBHash, err := txB.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a0Hash := addTestBlock(t, state, mineTestBlock(t, Hash{}, 0, minerA, []SignedTx{txA}))
+
+	tx, location, err := state.GetTx(txAHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if location.BlockHash != a0Hash || location.Height != 0 || location.Index != 0 || tx.Value != txA.Value {
+		t.Fatalf("TX must be indexed in block '%x' at height 0, got %+v", a0Hash, location)
+	}
+
+	// Reorg onto a branch with a different TX
+	b0Hash := addTestBlock(t, state, mineTestBlock(t, Hash{}, 0, minerB, nil))
+	b1Hash, _, err := state.ImportBlock(mineTestBlock(t, b0Hash, 1, minerB, []SignedTx{txB}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := state.GetTx(txAHash); !errors.Is(err, ErrTxNotFound) {
+		t.Fatalf("TX of a detached block must not be indexed, got %v", err)
+	}
+
+	assertIndexed := func(state *State) {
+		t.Helper()
+
+		_, location, err := state.GetTx(txBHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if location.BlockHash != b1Hash || location.Height != 1 {
+			t.Fatalf("TX must be indexed in block '%x' at height 1, got %+v", b1Hash, location)
+		}
+	}
+
+	assertIndexed(state)
+
+	if err := state.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Reindex(dataDir); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	assertIndexed(reloaded)
+
+	if _, _, err := reloaded.GetTx(txAHash); !errors.Is(err, ErrTxNotFound) {
+		t.Fatalf("reindexed TXs must only be from the main chain, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SortTxs orders the TXs the way the State applies them before TIP8 fork, by time and by nonce of TXs with the same time.
+func SortTxs(txs []SignedTx) {
+	sort.SliceStable(txs, func(i, j int) bool {
+		// The reward TXs lead the block
+		if txs[i].IsReward() || txs[j].IsReward() {
+			return txs[i].IsReward() && !txs[j].IsReward()
+		}
+
+		if txs[i].Time != txs[j].Time {
+			return txs[i].Time < txs[j].Time
+		}
+
+		return txs[i].Nonce < txs[j].Nonce
+	})
+}
+
+// OrderTxs returns the TXs in the order a block builder applies them since TIP8 fork, leaving the given slice untouched.
+//
+// The reward TXs lead the block, followed by the transfer paying the miner the highest fee, its tip above
+// the block base fee, among the lowest nonce TXs of every sender, and so on. Equal fees are ordered by time
+// and then by sender.
+func OrderTxs(txs []SignedTx, baseFee uint) []SignedTx {
+	ordered := make([]SignedTx, 0, len(txs))
+	senders := make([]common.Address, 0)
+	queues := make(map[common.Address][]SignedTx)
+
+	for _, tx := range txs {
+		if tx.IsReward() {
+			ordered = append(ordered, tx)
+			continue
+		}
+
+		if _, ok := queues[tx.From]; !ok {
+			senders = append(senders, tx.From)
+		}
+		queues[tx.From] = append(queues[tx.From], tx)
+	}
+
+	for _, queue := range queues {
+		sort.SliceStable(queue, func(i, j int) bool {
+			return queue[i].Nonce < queue[j].Nonce
+		})
+	}
+
+	for len(ordered) < len(txs) {
+		next := -1
+
+		for i, sender := range senders {
+			if len(queues[sender]) == 0 {
+				continue
+			}
+
+			if next < 0 || precedesTx(queues[sender][0], queues[senders[next]][0], baseFee) {
+				next = i
+			}
+		}
+
+		sender := senders[next]
+		ordered = append(ordered, queues[sender][0])
+		queues[sender] = queues[sender][1:]
+	}
+
+	return ordered
+}
+
+// precedesTx reports whether the block builder picks the TX a before b, both being the next TX of their senders.
+func precedesTx(a, b SignedTx, baseFee uint) bool {
+	if a.TipAt(baseFee) != b.TipAt(baseFee) {
+		return a.TipAt(baseFee) > b.TipAt(baseFee)
+	}
+
+	if a.Time != b.Time {
+		return a.Time < b.Time
+	}
+
+	return bytes.Compare(a.From.Bytes(), b.From.Bytes()) < 0
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestOrderTxs(t *testing.T) {
+	keyA, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyB, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	senderA := crypto.PubkeyToAddress(keyA.PublicKey)
+	senderB := crypto.PubkeyToAddress(keyB.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+
+	a1 := signTestTx(t, Tx{From: senderA, To: receiver, Gas: TxGas, GasPrice: 1, Value: 1, Nonce: 1, Time: 30}, keyA)
+	a2 := signTestTx(t, Tx{From: senderA, To: receiver, Gas: TxGas, GasPrice: 5, Value: 1, Nonce: 2, Time: 10}, keyA)
+	b1 := signTestTx(t, Tx{From: senderB, To: receiver, Gas: TxGas, GasPrice: 2, Value: 1, Nonce: 1, Time: 20}, keyB)
+	b2 := signTestTx(t, Tx{From: senderB, To: receiver, Gas: TxGas, GasPrice: 2, Value: 1, Nonce: 2, Time: 20}, keyB)
+	reward := NewRewardTx(receiver, BlockReward, 0, 0)
+
+	txs := []SignedTx{a2, b2, a1, reward, b1}
+	ordered := OrderTxs(txs, 0)
+
+	// A's cheap nonce 1 holds its expensive nonce 2 back until B's TXs paying more went first
+	expected := []SignedTx{reward, b1, b2, a1, a2}
+	for i := range expected {
+		if ordered[i].Nonce != expected[i].Nonce || ordered[i].From != expected[i].From {
+			t.Fatalf("TX %d must be %+v, got %+v", i, expected[i].Tx, ordered[i].Tx)
+		}
+	}
+
+	if txs[0].Nonce != 2 || txs[1].From != senderB || txs[3].From != (common.Address{}) {
+		t.Fatalf("ordering must leave the given TXs untouched, got %+v", txs)
+	}
+}
+
+func TestState_BlockOrderFork(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+
+	dataDir := setupTestDataDirWithGenesis(t, Genesis{
+		Balances: map[common.Address]uint{sender: 1000},
+		Forks:    map[string]uint64{ForkTIP2: 0, ForkTIP8: 1},
+	})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	mineBlock := func(parent Hash, number uint64, txs []SignedTx) Block {
+		b := NewBlock(parent, number, 0, 1650000000+number, miner, txs)
+		if err := b.CommitTxRoot(); err != nil {
+			t.Fatal(err)
+		}
+
+		return mineTestPreparedBlock(t, b)
+	}
+
+	// The clock of the sender went backwards between its two TXs
+	tx1 := signTestTx(t, Tx{From: sender, To: receiver, Gas: TxGas, GasPrice: 1, Value: 10, Nonce: 1, Time: 20}, key)
+	tx2 := signTestTx(t, Tx{From: sender, To: receiver, Gas: TxGas, GasPrice: 1, Value: 20, Nonce: 2, Time: 10}, key)
+
+	if _, err := state.AddBlock(mineBlock(Hash{}, 0, []SignedTx{tx1, tx2})); err == nil {
+		t.Fatal("block TXs not sorted by time must be rejected before TIP8")
+	}
+
+	b0Hash := addTestBlock(t, state, mineBlock(Hash{}, 0, nil))
+
+	if _, err := state.AddBlock(mineBlock(b0Hash, 1, []SignedTx{tx2, tx1})); err == nil {
+		t.Fatal("block TXs out of nonce order must be rejected since TIP8")
+	}
+
+	txs := []SignedTx{tx1, tx2}
+	addTestBlock(t, state, mineBlock(b0Hash, 1, txs))
+
+	if state.Balances[receiver] != 30 || txs[0].Nonce != 1 {
+		t.Fatalf("TXs must be applied in the block order, got receiver balance %d", state.Balances[receiver])
+	}
+}
@@ -0,0 +1,263 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+var readOnly = &opt.Options{ReadOnly: true, ErrorIfMissing: true}
+
+// ChainVerifyError reports the first stored block breaking a chain invariant.
+type ChainVerifyError struct {
+	Height uint64
+	Hash   Hash
+	Reason error
+}
+
+func (e *ChainVerifyError) Error() string {
+	return fmt.Sprintf("block %d '%x' is invalid: %s", e.Height, e.Hash, e.Reason)
+}
+
+func (e *ChainVerifyError) Unwrap() error {
+	return e.Reason
+}
+
+// ChainVerifyReport summarizes a successfully verified chain.
+type ChainVerifyReport struct {
+	Blocks  uint64 `json:"blocks"`
+	TipHash Hash   `json:"tip_hash"`
+
+	// Indexed is false when the FileDBEngine block.db index doesn't exist yet, it's built when the node starts
+	Indexed bool `json:"indexed"`
+}
+
+// VerifyChain walks the stored main chain without modifying the data dir, checking the genesis, the block
+// numbers, parent hashes, PoW, TX signatures, nonces and balances the way applyBlock does, and the hash
+// and height indexes pointing at every block.
+//
+// The first broken block is reported as a ChainVerifyError.
+func VerifyChain(dataDir string, miningDifficulty uint) (ChainVerifyReport, error) {
+	var report ChainVerifyReport
+
+	if err := checkDataDirInitialized(dataDir); err != nil {
+		return report, err
+	}
+
+	gen, err := loadGenesis(getGenesisJsonFilePath(dataDir))
+	if err != nil {
+		return report, fmt.Errorf("invalid genesis: %w", err)
+	}
+
+	if fileExists(getGenesisHashFilePath(dataDir)) {
+		if _, err := verifyGenesisHash(dataDir, gen); err != nil {
+			return report, fmt.Errorf("invalid genesis: %w", err)
+		}
+	}
+
+	state, err := newGenesisState(gen, dataDir, miningDifficulty, nil)
+	if err != nil {
+		return report, fmt.Errorf("invalid genesis: %w", err)
+	}
+
+	state.genesisHash, err = gen.Hash()
+	if err != nil {
+		return report, fmt.Errorf("invalid genesis: %w", err)
+	}
+
+	verifyBlock := func(blockFs BlockFS) error {
+		b := blockFs.Value
+		fail := func(format string, args ...interface{}) error {
+			return &ChainVerifyError{Height: b.Header.Number, Hash: blockFs.Key, Reason: fmt.Errorf(format, args...)}
+		}
+
+		// Like applyBlock, the number of the first block isn't checked, the node numbers it 1
+		if next := state.NextBlockNumber(); state.hasGenesisBlock && b.Header.Number != next {
+			return fail("block number is %d, expected %d", b.Header.Number, next)
+		}
+
+		if parent := state.NextBlockParent(); b.Header.Parent != parent {
+			return fail("parent hash is '%x', expected '%x'", b.Header.Parent, parent)
+		}
+
+		hash, err := b.Hash()
+		if err != nil {
+			return fail("%s", err)
+		}
+
+		if hash != blockFs.Key {
+			return fail("stored hash doesn't match the block hash '%x'", hash)
+		}
+
+		pendingState := state.Copy()
+		if err := applyBlock(b, &pendingState); err != nil {
+			return fail("%s", err)
+		}
+		state.commitBlock(&pendingState, hash, b, newAccountsUndo(state, &pendingState))
+
+		report.Blocks++
+		report.TipHash = hash
+
+		return nil
+	}
+
+	if dataDirDBEngine(dataDir) == LevelDBEngine {
+		return report, verifyLevelDBChain(dataDir, verifyBlock)
+	}
+
+	indexed, err := verifyFileChain(dataDir, verifyBlock, state.NextBlockNumber)
+	report.Indexed = indexed
+
+	return report, err
+}
+
+// verifyFileChain verifies the block.db records and, if the block.db index exists, the positions it holds.
+// The nextHeight is the height expected after the verified blocks.
+func verifyFileChain(dataDir string, verifyBlock func(BlockFS) error, nextHeight func() uint64) (bool, error) {
+	f, err := os.Open(getBlocksDbFilePath(dataDir))
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	// The store is only used to scan the records, without an index it never writes
+	store := &FileBlockStore{file: f, size: info.Size()}
+
+	var index *leveldb.DB
+	if fileExists(getBlocksIndexDirPath(dataDir)) {
+		index, err = leveldb.OpenFile(getBlocksIndexDirPath(dataDir), readOnly)
+		if err != nil {
+			return false, err
+		}
+		defer index.Close()
+	}
+
+	err = store.scan(0, func(blockFs BlockFS, filePosition int64) error {
+		if err := verifyBlock(blockFs); err != nil {
+			return err
+		}
+
+		if index == nil {
+			return nil
+		}
+
+		if err := verifyFileIndexEntries(index, blockFs, filePosition); err != nil {
+			return &ChainVerifyError{Height: blockFs.Value.Header.Number, Hash: blockFs.Key, Reason: err}
+		}
+
+		return nil
+	})
+
+	var torn *tornRecordError
+	if errors.As(err, &torn) {
+		return index != nil, &ChainVerifyError{Height: nextHeight(), Reason: torn}
+	}
+	if err != nil {
+		return index != nil, err
+	}
+
+	if index == nil {
+		return false, nil
+	}
+
+	value, err := index.Get(fileIndexMetaKey, nil)
+	if err == leveldb.ErrNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return true, err
+	}
+
+	var meta fileIndexMeta
+	if err := meta.decode(value); err != nil {
+		return true, fmt.Errorf("%w: %s", ErrCorruptBlockIndex, err)
+	}
+
+	if meta.Count > nextHeight() {
+		return true, fmt.Errorf("%w: indexed blocks up to height %d but block.db ends below it", ErrCorruptBlockIndex, meta.Count-1)
+	}
+
+	return true, nil
+}
+
+// verifyFileIndexEntries checks the hash and height index entries of the block, if it's indexed already.
+func verifyFileIndexEntries(index *leveldb.DB, blockFs BlockFS, filePosition int64) error {
+	height := blockFs.Value.Header.Number
+
+	heightValue, err := index.Get(fileIndexHeightKey(height), nil)
+	if err == leveldb.ErrNotFound {
+		// Blocks appended after the last indexed one are caught up when the store is opened
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(heightValue) != 40 {
+		return fmt.Errorf("%w: invalid height index entry", ErrCorruptBlockIndex)
+	}
+
+	if offset := int64(binary.BigEndian.Uint64(heightValue[:8])); offset != filePosition {
+		return fmt.Errorf("%w: height index points to offset %d instead of %d", ErrCorruptBlockIndex, offset, filePosition)
+	}
+
+	if !bytes.Equal(heightValue[8:], blockFs.Key[:]) {
+		return fmt.Errorf("%w: height index holds hash '%x'", ErrCorruptBlockIndex, heightValue[8:])
+	}
+
+	hashValue, err := index.Get(fileIndexHashKey(blockFs.Key), nil)
+	if err == leveldb.ErrNotFound {
+		return fmt.Errorf("%w: hash index entry is missing", ErrCorruptBlockIndex)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(hashValue) != 8 {
+		return fmt.Errorf("%w: invalid hash index entry", ErrCorruptBlockIndex)
+	}
+
+	if offset := int64(binary.BigEndian.Uint64(hashValue)); offset != filePosition {
+		return fmt.Errorf("%w: hash index points to offset %d instead of %d", ErrCorruptBlockIndex, offset, filePosition)
+	}
+
+	return nil
+}
+
+// verifyLevelDBChain verifies the blocks of the LevelDBEngine and their hash -> height keys.
+func verifyLevelDBChain(dataDir string, verifyBlock func(BlockFS) error) error {
+	db, err := leveldb.OpenFile(getBlocksLevelDBDirPath(dataDir), readOnly)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	store := &LevelDBBlockStore{db: db}
+
+	return store.Iterate(0, func(blockFs BlockFS) error {
+		if err := verifyBlock(blockFs); err != nil {
+			return err
+		}
+
+		height, err := db.Get(levelDBHashKey(blockFs.Key), nil)
+		if err != nil && err != leveldb.ErrNotFound {
+			return err
+		}
+
+		if err == leveldb.ErrNotFound || len(height) != 8 || binary.BigEndian.Uint64(height) != blockFs.Value.Header.Number {
+			return &ChainVerifyError{Height: blockFs.Value.Header.Number, Hash: blockFs.Key, Reason: fmt.Errorf("hash key doesn't point to the block height")}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestVerifyChain(t *testing.T) {
+	senderKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(senderKey.PublicKey)
+	receiver := NewAccount("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+
+	dataDir := setupTestDataDir(t, map[common.Address]uint{sender: 1000})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent := Hash{}
+	for i := uint64(0); i < 3; i++ {
+		tx := signTestTx(t, NewBaseTx(sender, receiver, 10, uint(i+1), ""), senderKey)
+		parent = addTestBlock(t, state, mineTestBlock(t, parent, i, miner, []SignedTx{tx}))
+	}
+
+	if err := state.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := VerifyChain(dataDir, testMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Blocks != 3 || report.TipHash != parent || !report.Indexed {
+		t.Fatalf("expected 3 indexed blocks up to '%x', got %+v", parent, report)
+	}
+
+	// Store a block spending more than the sender owns, bypassing the State validation
+	store, err := NewFileBlockStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	overspend := signTestTx(t, NewBaseTx(sender, receiver, 5000, 4, ""), senderKey)
+	b := mineTestBlock(t, parent, 3, miner, []SignedTx{overspend})
+	bHash, err := b.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Append(bHash, b); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var verifyErr *ChainVerifyError
+
+	_, err = VerifyChain(dataDir, testMiningDifficulty)
+	if !errors.As(err, &verifyErr) || verifyErr.Height != 3 || verifyErr.Hash != bHash {
+		t.Fatalf("block 3 must be reported invalid, got %v", err)
+	}
+
+	// Drop the invalid block and point the height index of block 1 at a different hash
+	store, err = NewFileBlockStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Truncate(3); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := leveldb.OpenFile(getBlocksIndexDirPath(dataDir), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := index.Get(fileIndexHeightKey(1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := index.Put(fileIndexHeightKey(1), append(value[:8:8], parent[:]...), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := index.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = VerifyChain(dataDir, testMiningDifficulty)
+	if !errors.As(err, &verifyErr) || verifyErr.Height != 1 || !errors.Is(err, ErrCorruptBlockIndex) {
+		t.Fatalf("corrupt index entry of block 1 must be reported, got %v", err)
+	}
+}
+
+func TestVerifyChain_FromHeightOne(t *testing.T) {
+	miner := NewAccount("0x00000000000000000000000000000000000000aa")
+
+	dataDir := setupTestDataDir(t, map[common.Address]uint{miner: 1000})
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, testMiningDifficulty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The node numbers its first mined block 1
+	parent := Hash{}
+	for i := uint64(1); i <= 3; i++ {
+		parent = addTestBlock(t, state, mineTestBlock(t, parent, i, miner, nil))
+	}
+
+	if err := state.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := VerifyChain(dataDir, testMiningDifficulty)
+	if err != nil {
+		t.Fatalf("chain starting at height 1 must be valid: %s", err)
+	}
+
+	if report.Blocks != 3 || report.TipHash != parent || !report.Indexed {
+		t.Fatalf("expected 3 indexed blocks up to '%x', got %+v", parent, report)
+	}
+
+	// Store a block skipping a height, bypassing the State validation
+	store, err := NewFileBlockStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := mineTestBlock(t, parent, 5, miner, nil)
+	bHash, err := b.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Append(bHash, b); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var verifyErr *ChainVerifyError
+
+	_, err = VerifyChain(dataDir, testMiningDifficulty)
+	if !errors.As(err, &verifyErr) || verifyErr.Height != 5 || verifyErr.Hash != bHash {
+		t.Fatalf("block 5 after block 3 must be reported invalid, got %v", err)
+	}
+}
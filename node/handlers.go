@@ -15,12 +15,152 @@ import (
 func listBalancesHandler(w http.ResponseWriter, r *http.Request, state *database.State) {
 	enableCors(&w)
 
-	writeRes(w, BalancesRes{
-		Hash:     state.LatestBlockHash(),
-		Balances: state.Balances,
+	if strings.TrimSpace(r.URL.Query().Get(endpointBalancesQueryKeyAt)) == "" {
+		writeRes(w, newBalancesRes(database.Accounts{
+			BlockHash: state.LatestBlockHash(),
+			Height:    state.LatestBlock().Header.Number,
+			Balances:  state.Balances,
+			Immature:  state.ImmatureBalances(),
+		}))
+		return
+	}
+
+	height, err := queryBlockHeight(r, state, endpointBalancesQueryKeyAt)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	accounts, err := state.AccountsAt(height)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, newBalancesRes(accounts))
+}
+
+func newBalancesRes(accounts database.Accounts) BalancesRes {
+	spendable := make(map[common.Address]uint, len(accounts.Balances))
+	for account := range accounts.Balances {
+		spendable[account] = accounts.Spendable(account)
+	}
+
+	return BalancesRes{
+		Hash:      accounts.BlockHash,
+		Number:    accounts.Height,
+		Balances:  accounts.Balances,
+		Spendable: spendable,
+		Immature:  accounts.Immature,
+	}
+}
+
+// balancesHandler serves /balances/{address}, the account balance and nonce, and /balances/{address}/proof,
+// proving them. Both are after the block given by height or hash, the latest block by default.
+func balancesHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	enableCors(&w)
+
+	params := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(params) < 2 || len(params) > 3 || (len(params) == 3 && params[2] != endpointBalanceProof) {
+		writeErrRes(w, fmt.Errorf("unknown balances resource '%s'", r.URL.Path))
+		return
+	}
+
+	if !common.IsHexAddress(params[1]) {
+		writeErrRes(w, fmt.Errorf("invalid account: '%s'", params[1]))
+		return
+	}
+	account := database.NewAccount(params[1])
+
+	height, err := queryBlockHeight(r, node.state, endpointBalancesQueryKeyAt)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	if len(params) == 3 {
+		proof, err := database.GetAccountProof(node.state, account, height)
+		if err != nil {
+			writeErrRes(w, err)
+			return
+		}
+
+		writeRes(w, proof)
+		return
+	}
+
+	accounts, err := node.state.AccountsAt(height)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, BalanceRes{
+		Hash:      accounts.BlockHash,
+		Number:    accounts.Height,
+		Account:   account,
+		Balance:   accounts.Balances[account],
+		Spendable: accounts.Spendable(account),
+		Immature:  accounts.Immature[account],
+		Nonce:     accounts.Account2Nonce[account],
 	})
 }
 
+// queryBlockHeight returns the height of the main chain block given by height or hash under the query key,
+// the latest block if the key is missing.
+func queryBlockHeight(r *http.Request, state *database.State, key string) (uint64, error) {
+	reqBlock := strings.TrimSpace(r.URL.Query().Get(key))
+	if reqBlock == "" {
+		return state.LatestBlock().Header.Number, nil
+	}
+
+	var hash string
+
+	reqHeight, err := strconv.ParseUint(reqBlock, 10, 64)
+	if err != nil {
+		hash = reqBlock
+	}
+
+	block, err := database.GetBlockByHeightOrHash(state, reqHeight, hash)
+	if err != nil {
+		return 0, err
+	}
+
+	return block.Value.Header.Number, nil
+}
+
+// feesEstimateHandler serves the suggested fees of a TX to be included in the next block.
+func feesEstimateHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	enableCors(&w)
+
+	writeRes(w, node.state.EstimateFees())
+}
+
+// chainSupplyHandler serves the premined, minted, burned and circulating supply after the block
+// given by height or hash, the latest block by default.
+func chainSupplyHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	enableCors(&w)
+
+	if strings.TrimSpace(r.URL.Query().Get(endpointChainSupplyQueryKeyAt)) == "" {
+		writeRes(w, node.state.Supply())
+		return
+	}
+
+	height, err := queryBlockHeight(r, node.state, endpointChainSupplyQueryKeyAt)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	supply, err := node.state.SupplyAt(height)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, supply)
+}
+
 func txAddHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	req := TxAddReq{}
 	err := readReq(r, &req)
@@ -41,16 +181,38 @@ func txAddHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 		return
 	}
 
+	// Missing fees are the suggested ones, see /fees/estimate
+	rules := node.state.Rules()
+	estimate := node.state.EstimateFees()
+
 	if req.Gas == 0 {
-		req.Gas = 1
+		req.Gas = estimate.Gas
 	}
 
-	if req.GasPrice == 0 {
-		req.GasPrice = 21
+	if rules.IsTIP11 {
+		if req.GasPrice != 0 {
+			writeErrRes(w, fmt.Errorf("'gasPrice' is replaced by 'maxFee' and 'tip' since TIP11 fork"))
+			return
+		}
+
+		if req.Tip == 0 {
+			req.Tip = estimate.Tip
+		}
+
+		if req.MaxFee == 0 {
+			req.MaxFee = estimate.MaxFee
+		}
+	} else if req.GasPrice == 0 {
+		req.GasPrice = estimate.GasPrice
 	}
 
 	nonce := node.state.GetNextAccountNonce(from)
 	tx := database.NewTx(from, database.NewAccount(req.To), req.Gas, req.GasPrice, req.Value, nonce, req.Data)
+	tx.MaxFee = req.MaxFee
+	tx.Tip = req.Tip
+	if rules.IsTIP4 {
+		tx.ChainID = rules.ChainID
+	}
 
 	signedTx, err := wallet.SignTxWithKeystoreAccount(tx, from, req.FromPwd, wallet.GetKeystoreDirPath(node.dataDir))
 	if err != nil {
@@ -66,30 +228,112 @@ func txAddHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	writeRes(w, TxAddRes{Success: true})
 }
 
+// txHandler serves the TX resources: /tx/{hash} and its /tx/{hash}/proof inclusion proof.
+func txHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	enableCors(&w)
+
+	params := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(params) < 2 || len(params) > 3 || (len(params) == 3 && params[2] != endpointTxProof) {
+		writeErrRes(w, fmt.Errorf("unknown TX resource '%s'", r.URL.Path))
+		return
+	}
+
+	txHash := database.Hash{}
+	err := txHash.UnmarshalText([]byte(params[1]))
+	if err != nil {
+		writeErrRes(w, fmt.Errorf("invalid TX hash: '%s'", params[1]))
+		return
+	}
+
+	if len(params) == 3 {
+		proof, err := database.GetTxInclusionProof(node.state, txHash)
+		if err != nil {
+			writeErrRes(w, err)
+			return
+		}
+
+		writeRes(w, proof)
+		return
+	}
+
+	tx, location, err := node.state.GetTx(txHash)
+	if errors.Is(err, database.ErrTxNotFound) {
+		if tx, isPending := node.pendingTXs[txHash.Hex()]; isPending {
+			writeRes(w, TxRes{Tx: tx, Pending: true})
+			return
+		}
+
+		writeErrRes(w, fmt.Errorf("TX '%s' is neither mined nor pending", txHash.Hex()))
+		return
+	}
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, TxRes{
+		Tx:            tx,
+		Block:         &location,
+		Confirmations: node.state.LatestBlock().Header.Number - location.Height + 1,
+	})
+}
+
 func statusHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	enableCors(&w)
 
 	res := StatusRes{
-		Hash:       node.state.LatestBlockHash(),
-		Number:     node.state.LatestBlock().Header.Number,
-		KnownPeers: node.knownPeers,
-		PendingTxs: node.getPendingTXsAsArray(),
+		Hash:        node.state.LatestBlockHash(),
+		Number:      node.state.LatestBlock().Header.Number,
+		GenesisHash: node.state.GenesisHash(),
+		ChainWork:   node.state.ChainWork(),
+		KnownPeers:  node.knownPeers,
+		PendingTxs:  node.getPendingTXsAsArray(),
+	}
+
+	writeRes(w, res)
+}
+
+// forksHandler serves the fork schedule, marking the forks active for the next block.
+func forksHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	enableCors(&w)
+
+	nextNumber := node.state.NextBlockNumber()
+
+	res := ForksRes{
+		NextNumber: nextNumber,
+		Forks:      node.state.ChainConfig().Schedule(nextNumber),
 	}
 
 	writeRes(w, res)
 }
 
 func syncHandler(w http.ResponseWriter, r *http.Request, node *Node) {
-	reqHash := r.URL.Query().Get(endpointSyncQueryKeyFromBlock)
+	reqHashes := strings.Split(r.URL.Query().Get(endpointSyncQueryKeyFromBlock), ",")
+
+	// The requesting peer sends a locator of its recent blocks, starting from its tip.
+	// Blocks are sent from the most recent one we have in our main chain.
+	var fromBlock *database.Hash
+
+	for _, reqHash := range reqHashes {
+		hash := database.Hash{}
+		err := hash.UnmarshalText([]byte(reqHash))
+		if err != nil {
+			writeErrRes(w, err)
+			return
+		}
+
+		if hash.IsEmpty() || node.state.IsMainChainBlock(hash) {
+			fromBlock = &hash
+			break
+		}
+	}
 
-	hash := database.Hash{}
-	err := hash.UnmarshalText([]byte(reqHash))
-	if err != nil {
-		writeErrRes(w, err)
+	if fromBlock == nil {
+		writeErrRes(w, fmt.Errorf("none of the requested blocks is part of the main chain"))
 		return
 	}
 
-	blocks, err := database.GetBlocksAfter(hash, node.dataDir)
+	blocks, err := database.GetBlocksAfter(*fromBlock, node.state)
 	if err != nil {
 		writeErrRes(w, err)
 		return
@@ -120,6 +364,77 @@ func addPeerHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	writeRes(w, AddPeerRes{Success: true})
 }
 
+// addressTxsHandler serves /address/{addr}/txs, a page of the address history optionally filtered
+// by direction and an inclusive range of block heights.
+func addressTxsHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	enableCors(&w)
+
+	params := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(params) != 3 || params[2] != endpointAddressTxs {
+		writeErrRes(w, fmt.Errorf("unknown address resource '%s'", r.URL.Path))
+		return
+	}
+
+	if !common.IsHexAddress(params[1]) {
+		writeErrRes(w, fmt.Errorf("invalid account: '%s'", params[1]))
+		return
+	}
+
+	query := r.URL.Query()
+	filter := database.AddressHistoryFilter{
+		Direction: query.Get(endpointAddressTxsQueryKeyDirection),
+		Limit:     addressTxsDefaultLimit,
+	}
+
+	var err error
+	parseUint := func(key string, dst *uint64) {
+		raw := strings.TrimSpace(query.Get(key))
+		if raw == "" || err != nil {
+			return
+		}
+
+		*dst, err = strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			err = fmt.Errorf("invalid '%s': '%s'", key, raw)
+		}
+	}
+
+	var toHeight, offset, limit uint64 = 0, 0, uint64(filter.Limit)
+	parseUint(endpointAddressTxsQueryKeyFromHeight, &filter.FromHeight)
+	parseUint(endpointAddressTxsQueryKeyToHeight, &toHeight)
+	parseUint(endpointAddressTxsQueryKeyOffset, &offset)
+	parseUint(endpointAddressTxsQueryKeyLimit, &limit)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	if query.Get(endpointAddressTxsQueryKeyToHeight) != "" {
+		filter.ToHeight = &toHeight
+	}
+
+	if limit == 0 || limit > addressTxsMaxLimit {
+		writeErrRes(w, fmt.Errorf("'%s' must be between 1 and %d", endpointAddressTxsQueryKeyLimit, addressTxsMaxLimit))
+		return
+	}
+	filter.Offset = int(offset)
+	filter.Limit = int(limit)
+
+	history, err := node.state.GetAddressHistory(database.NewAccount(params[1]), filter)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, AddressTxsRes{
+		Account: database.NewAccount(params[1]),
+		Txs:     history.Txs,
+		Total:   history.Total,
+		Offset:  filter.Offset,
+		Limit:   filter.Limit,
+	})
+}
+
 func getBlockByNumberOrHashHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	enableCors(&w)
 
@@ -144,7 +459,7 @@ func getBlockByNumberOrHashHandler(w http.ResponseWriter, r *http.Request, node
 		hash = p
 	}
 
-	block, err := database.GetBlockByHeightOrHash(node.state, height, hash, node.dataDir)
+	block, err := database.GetBlockByHeightOrHash(node.state, height, hash)
 	if err != nil {
 		writeErrRes(w, err)
 		return
@@ -58,7 +58,7 @@ func TestNode_MempoolView(t *testing.T) {
 
 	n := New(dataDir, nInfo.IP, nInfo.Port, patrick, nInfo, DefaultMiningDifficulty)
 
-	state, err := database.NewStateFromDisk(n.dataDir, n.miningDifficulty)
+	state, err := database.NewStateFromDisk(n.dataDir, n.miningDifficulty, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
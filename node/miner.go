@@ -3,6 +3,7 @@ package node
 import (
 	"context"
 	"fmt"
+	"math"
 	"math/rand"
 	"time"
 
@@ -11,11 +12,23 @@ import (
 )
 
 type PendingBlock struct {
-	parent database.Hash
-	number uint64
-	time   uint64
-	miner  common.Address
-	txs    []database.SignedTx
+	parent    database.Hash
+	number    uint64
+	time      uint64
+	miner     common.Address
+	txs       []database.SignedTx
+	txRoot    *database.Hash
+	stateRoot *database.Hash
+
+	// rewards lead the mined block TXs since TIP7 fork
+	rewards []database.SignedTx
+
+	// difficulty is committed in the mined block header since TIP5 fork, replaced by the bits since TIP6 fork
+	difficulty uint
+	bits       uint32
+
+	// baseFee is committed in the mined block header since TIP11 fork
+	baseFee uint
 }
 
 func NewPendingBlock(parent database.Hash, number uint64, miner common.Address, txs []database.SignedTx) PendingBlock {
@@ -28,11 +41,138 @@ func NewPendingBlock(parent database.Hash, number uint64, miner common.Address,
 	}
 }
 
+// block returns the block with the reward TXs, if any, followed by the pending TXs.
+func (pb *PendingBlock) block(nonce uint32) database.Block {
+	txs := make([]database.SignedTx, 0, len(pb.rewards)+len(pb.txs))
+	txs = append(txs, pb.rewards...)
+	txs = append(txs, pb.txs...)
+
+	b := database.NewBlock(pb.parent, pb.number, nonce, pb.time, pb.miner, txs)
+	b.Header.TxRoot = pb.txRoot
+	b.Header.StateRoot = pb.stateRoot
+	b.Header.Difficulty = pb.difficulty
+	b.Header.Bits = pb.bits
+	b.Header.BaseFee = pb.baseFee
+
+	return b
+}
+
+// reward splits the block reward with the fees of the pending TXs among the beneficiaries, required since TIP7 fork.
+func (pb *PendingBlock) reward(state *database.State, shares []database.RewardShare) {
+	pb.rewards = database.NewRewardTxs(state.NextBlockReward(pb.txs), pb.number, pb.time, shares)
+}
+
+// orderTxs orders the pending TXs by fee and sender nonce, the block order the State applies since TIP8 fork.
+//
+// TXs the State can't apply on top of the ones before them, e.g. spending a transfer ordered after them,
+// are moved behind it or, if still invalid, left out of the block and stay in the Mempool.
+func (pb *PendingBlock) orderTxs(state *database.State) {
+	pendingState := state.Copy()
+
+	candidates := database.OrderTxs(pb.txs, pb.baseFee)
+	txs := make([]database.SignedTx, 0, len(candidates))
+
+	for len(candidates) > 0 {
+		deferred := make([]database.SignedTx, 0)
+
+		for _, tx := range candidates {
+			if err := database.ApplyTx(tx, &pendingState); err != nil {
+				deferred = append(deferred, tx)
+				continue
+			}
+
+			txs = append(txs, tx)
+		}
+
+		if len(deferred) == len(candidates) {
+			break
+		}
+		candidates = deferred
+	}
+
+	pb.txs = txs
+}
+
+// fitLimits leaves out the pending TXs overflowing the block gas limit or maximum block size, required since
+// TIP10 fork. They stay in the Mempool for the next block.
+//
+// The TXs are measured in the block as it will be mined, with the largest nonce and roots yet to be committed.
+func (pb *PendingBlock) fitLimits(config database.ChainConfig, rules database.Rules) error {
+	// Before TIP8 fork the TXs are applied by time, the ones left out must be the latest
+	if !rules.IsTIP8 {
+		database.SortTxs(pb.txs)
+	}
+
+	template := pb.block(math.MaxUint32)
+	template.Txs = pb.rewards
+
+	if rules.IsTIP2 {
+		template.Header.TxRoot = &database.Hash{}
+	}
+
+	if rules.IsTIP3 {
+		template.Header.StateRoot = &database.Hash{}
+	}
+
+	txs, err := config.FitBlockLimits(template, pb.txs)
+	if err != nil {
+		return err
+	}
+
+	pb.txs = txs
+
+	return nil
+}
+
+// commitTxs commits the TXs Merkle root in the mined block header, required since TIP2 fork.
+// Before TIP8 fork the TXs are sorted by time first.
+func (pb *PendingBlock) commitTxs(rules database.Rules) error {
+	b := pb.block(0)
+
+	commit := b.CommitTxs
+	if rules.IsTIP8 {
+		commit = b.CommitTxRoot
+	}
+
+	if err := commit(); err != nil {
+		return err
+	}
+
+	pb.txs = b.Txs[len(pb.rewards):]
+	pb.txRoot = b.Header.TxRoot
+
+	return nil
+}
+
+// commitState commits the State root after the mined block in its header, required since TIP3 fork.
+func (pb *PendingBlock) commitState(state *database.State) error {
+	b := pb.block(0)
+
+	root, err := state.StateRootAfter(b)
+	if err != nil {
+		return err
+	}
+
+	pb.stateRoot = &root
+
+	return nil
+}
+
+// Mine searches for a nonce the block hash meets the PoW target with, the target of the committed bits
+// or of the given difficulty before TIP6 fork.
 func Mine(ctx context.Context, pb PendingBlock, miningDifficulty uint) (database.Block, error) {
 	if len(pb.txs) == 0 {
 		return database.Block{}, fmt.Errorf("mining empty block is not allowed")
 	}
 
+	target := database.DifficultyTarget(miningDifficulty)
+	if pb.bits != 0 {
+		var err error
+		if target, err = database.CompactToTarget(pb.bits); err != nil {
+			return database.Block{}, fmt.Errorf("couldn't mine block. %s", err.Error())
+		}
+	}
+
 	var block database.Block
 	var hash database.Hash
 	var nonce uint32
@@ -40,7 +180,7 @@ func Mine(ctx context.Context, pb PendingBlock, miningDifficulty uint) (database
 	start := time.Now()
 	attempt := 0
 
-	for !database.IsBlockHashValid(hash, miningDifficulty) {
+	for attempt == 0 || !hash.MeetsPoW(&target, pb.bits != 0) {
 		select {
 		case <-ctx.Done():
 			fmt.Println("Mining cancelled!")
@@ -55,7 +195,7 @@ func Mine(ctx context.Context, pb PendingBlock, miningDifficulty uint) (database
 				fmt.Printf("Mining %d Pending TXs. Attempt: %d\n", len(pb.txs), attempt)
 			}
 
-			block = database.NewBlock(pb.parent, pb.number, nonce, pb.time, pb.miner, pb.txs)
+			block = pb.block(nonce)
 			blockHash, err := block.Hash()
 			if err != nil {
 				return database.Block{}, fmt.Errorf("couldn't mine block. %s", err.Error())
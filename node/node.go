@@ -20,9 +20,15 @@ const DefaultIP = "127.0.0.1"
 const DefaultHttpPort = 8080
 
 const endpointListBalances = "/balances/list"
+const endpointBalances = "/balances/"
+const endpointBalancesQueryKeyAt = "at"
+const endpointBalanceProof = "proof"
 const endpointAddTx = "/tx/add"
+const endpointTx = "/tx/"
+const endpointTxProof = "proof"
 
 const endpointStatus = "/node/status"
+const endpointForks = "/node/forks"
 const endpointSync = "/node/sync"
 const endpointSyncQueryKeyFromBlock = "fromBlock"
 
@@ -31,12 +37,33 @@ const endpointAddPeerQueryKeyIP = "ip"
 const endpointAddPeerQueryKeyPort = "port"
 const endpointAddPeerQueryKeyMiner = "miner"
 
+const endpointAddress = "/address/"
+const endpointAddressTxs = "txs"
+const endpointAddressTxsQueryKeyDirection = "direction"
+const endpointAddressTxsQueryKeyFromHeight = "from_height"
+const endpointAddressTxsQueryKeyToHeight = "to_height"
+const endpointAddressTxsQueryKeyOffset = "offset"
+const endpointAddressTxsQueryKeyLimit = "limit"
+const addressTxsDefaultLimit = 50
+const addressTxsMaxLimit = 500
+
+const endpointChainSupply = "/chain/supply"
+const endpointChainSupplyQueryKeyAt = "at"
+
+const endpointFeesEstimate = "/fees/estimate"
+
 const endpointBlockByNumberOrHash = "/block/"
 const endpointMempoolViewer = "/mempool/"
 
 const miningIntervalSeconds = 10
 const DefaultMiningDifficulty = 3
 
+// DefaultMaxFutureBlockDrift is how many seconds ahead of the node time a block can be, later ones are deferred
+const DefaultMaxFutureBlockDrift = 2 * 60 * 60
+
+// maxDeferredBlocks bounds the synced blocks waiting for the node time to catch up with them
+const maxDeferredBlocks = 100
+
 type PeerNode struct {
 	IP          string         `json:"ip"`
 	Port        uint64         `json:"port"`
@@ -78,6 +105,16 @@ type Node struct {
 
 	miningDifficulty uint
 	isMining         bool
+
+	// BlockStore engine, empty means the one the data dir was created with
+	dbEngine string
+
+	// Beneficiaries of the mined blocks reward since TIP7 fork, empty means the miner account only
+	rewardShares []database.RewardShare
+
+	// Synced blocks too far in the future, imported once the node time reaches them
+	maxFutureDrift uint64
+	deferredBlocks map[database.Hash]database.Block
 }
 
 func New(dataDir string, ip string, port uint64, acc common.Address, bootstrap PeerNode, miningDifficulty uint) *Node {
@@ -94,19 +131,28 @@ func New(dataDir string, ip string, port uint64, acc common.Address, bootstrap P
 		newPendingTXs:    make(chan database.SignedTx, 10000),
 		isMining:         false,
 		miningDifficulty: miningDifficulty,
+		maxFutureDrift:   DefaultMaxFutureBlockDrift,
+		deferredBlocks:   make(map[database.Hash]database.Block),
 	}
 }
 
 func (n *Node) Run(ctx context.Context) error {
 	fmt.Println(fmt.Sprintf("Listening on: %s:%d", n.info.IP, n.info.Port))
 
-	state, err := database.NewStateFromDisk(n.dataDir, n.miningDifficulty)
+	store, err := database.OpenBlockStore(n.dataDir, n.dbEngine)
+	if err != nil {
+		return err
+	}
+
+	state, err := database.NewStateFromDisk(n.dataDir, n.miningDifficulty, store)
 	if err != nil {
+		_ = store.Close()
 		return err
 	}
 	defer state.Close()
 
 	n.state = state
+	n.miningDifficulty = state.MiningDifficulty()
 
 	pendingState := state.Copy()
 	n.pendingState = &pendingState
@@ -124,14 +170,26 @@ func (n *Node) Run(ctx context.Context) error {
 		listBalancesHandler(w, r, state)
 	})
 
+	handler.HandleFunc(endpointBalances, func(w http.ResponseWriter, r *http.Request) {
+		balancesHandler(w, r, n)
+	})
+
 	handler.HandleFunc(endpointAddTx, func(w http.ResponseWriter, r *http.Request) {
 		txAddHandler(w, r, n)
 	})
 
+	handler.HandleFunc(endpointTx, func(w http.ResponseWriter, r *http.Request) {
+		txHandler(w, r, n)
+	})
+
 	handler.HandleFunc(endpointStatus, func(w http.ResponseWriter, r *http.Request) {
 		statusHandler(w, r, n)
 	})
 
+	handler.HandleFunc(endpointForks, func(w http.ResponseWriter, r *http.Request) {
+		forksHandler(w, r, n)
+	})
+
 	handler.HandleFunc(endpointSync, func(w http.ResponseWriter, r *http.Request) {
 		syncHandler(w, r, n)
 	})
@@ -140,6 +198,18 @@ func (n *Node) Run(ctx context.Context) error {
 		addPeerHandler(w, r, n)
 	})
 
+	handler.HandleFunc(endpointAddress, func(w http.ResponseWriter, r *http.Request) {
+		addressTxsHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointChainSupply, func(w http.ResponseWriter, r *http.Request) {
+		chainSupplyHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointFeesEstimate, func(w http.ResponseWriter, r *http.Request) {
+		feesEstimateHandler(w, r, n)
+	})
+
 	handler.HandleFunc(endpointBlockByNumberOrHash, func(w http.ResponseWriter, r *http.Request) {
 		getBlockByNumberOrHashHandler(w, r, n)
 	})
@@ -211,13 +281,67 @@ func (n *Node) mine(ctx context.Context) error {
 
 func (n *Node) minePendingTXs(ctx context.Context) error {
 	blockToMine := NewPendingBlock(
-		n.state.LatestBlockHash(),
+		n.state.NextBlockParent(),
 		n.state.LatestBlock().Header.Number+1,
 		n.info.Account,
 		n.getPendingTXsAsArray(),
 	)
 
-	minedBlock, err := Mine(ctx, blockToMine, n.miningDifficulty)
+	rules := n.state.Rules()
+
+	if rules.IsTIP9 {
+		blockToMine.time = n.state.NextBlockTime(blockToMine.time)
+	}
+
+	miningDifficulty := n.miningDifficulty
+	if rules.IsTIP6 {
+		blockToMine.bits = n.state.NextBits()
+	} else if rules.IsTIP5 {
+		miningDifficulty = n.state.NextDifficulty()
+		blockToMine.difficulty = miningDifficulty
+	}
+
+	if rules.IsTIP11 {
+		blockToMine.baseFee = rules.BaseFee
+	}
+
+	if rules.IsTIP8 {
+		blockToMine.orderTxs(n.state)
+	}
+
+	shares := n.rewardShares
+	if len(shares) == 0 {
+		shares = []database.RewardShare{{Account: n.info.Account, Weight: 1}}
+	}
+
+	if rules.IsTIP10 {
+		// The reward of all the pending TXs is the largest the reward TXs can get
+		if rules.IsTIP7 {
+			blockToMine.reward(n.state, shares)
+		}
+
+		if err := blockToMine.fitLimits(n.state.ChainConfig(), rules); err != nil {
+			return err
+		}
+	}
+
+	if rules.IsTIP7 {
+		blockToMine.reward(n.state, shares)
+	}
+
+	if rules.IsTIP2 {
+		if err := blockToMine.commitTxs(rules); err != nil {
+			return err
+		}
+	}
+
+	if rules.IsTIP3 {
+		if err := blockToMine.commitState(n.state); err != nil {
+			return err
+		}
+	}
+
+	minedBlock, err := Mine(ctx, blockToMine, miningDifficulty)
 	if err != nil {
 		return err
 	}
@@ -253,6 +377,20 @@ func (n *Node) ChangeMiningDifficulty(newDifficulty uint) {
 	n.state.ChangeMiningDifficulty(newDifficulty)
 }
 
+func (n *Node) ChangeDBEngine(engine string) {
+	n.dbEngine = engine
+}
+
+// ChangeMaxFutureDrift changes how many seconds ahead of the node time a block can be before it's deferred.
+func (n *Node) ChangeMaxFutureDrift(seconds uint64) {
+	n.maxFutureDrift = seconds
+}
+
+// ChangeRewardShares splits the reward of the mined blocks among the beneficiaries since TIP7 fork.
+func (n *Node) ChangeRewardShares(shares []database.RewardShare) {
+	n.rewardShares = shares
+}
+
 func (n *Node) AddPeer(peer PeerNode) {
 	n.knownPeers[peer.TcpAddress()] = peer
 }
@@ -299,10 +437,15 @@ func (n *Node) AddPendingTX(tx database.SignedTx, fromPeer PeerNode) error {
 	return nil
 }
 
-// addBlock is a wrapper around the n.state.AddBlock() to have a single function for changing the main state
+// addBlock is a wrapper around the n.state.ImportBlock() to have a single function for changing the main state
 // from the Node perspective, so we can also reset the pending state in the same time.
 func (n *Node) addBlock(block database.Block) error {
-	_, err := n.state.AddBlock(block)
+	err := database.VerifyBlockTimeDrift(block, uint64(time.Now().Unix()), n.maxFutureDrift)
+	if err != nil {
+		return err
+	}
+
+	_, reorg, err := n.state.ImportBlock(block)
 	if err != nil {
 		return err
 	}
@@ -311,9 +454,39 @@ func (n *Node) addBlock(block database.Block) error {
 	pendingState := n.state.Copy()
 	n.pendingState = &pendingState
 
+	if reorg != nil {
+		n.restoreOrphanedTXs(reorg)
+	}
+
 	return nil
 }
 
+// restoreOrphanedTXs returns TXs from blocks detached by a reorg back to the Mempool,
+// so they can be mined again on top of the new main chain.
+func (n *Node) restoreOrphanedTXs(reorg *database.Reorg) {
+	for _, block := range reorg.Attached {
+		n.removeMinedPendingTXs(block)
+	}
+
+	for _, tx := range reorg.OrphanedTXs() {
+		txHash, err := tx.Hash()
+		if err != nil {
+			continue
+		}
+
+		err = n.validateTxBeforeAddingToMempool(tx)
+		if err != nil {
+			fmt.Printf("\tdropping orphaned TX %s: %s\n", txHash.Hex(), err)
+			continue
+		}
+
+		fmt.Printf("\trestoring orphaned TX: %s\n", txHash.Hex())
+
+		delete(n.archivedTXs, txHash.Hex())
+		n.pendingTXs[txHash.Hex()] = tx
+	}
+}
+
 // validateTxBeforeAddingToMempool ensures the TX is authentic, with correct nonce, and the sender has sufficient
 // funds so we waste PoW resources on TX we can tell in advance are wrong.
 func (n *Node) validateTxBeforeAddingToMempool(tx database.SignedTx) error {
@@ -31,6 +31,11 @@ func TestNode_Run(t *testing.T) {
 	}
 	defer fs.RemoveDir(dataDir)
 
+	err = database.InitDataDir(dataDir, database.DefaultGenesisJson())
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	n := New(dataDir, "127.0.0.1", 8085, database.NewAccount(DefaultMiner), PeerNode{}, defaultTestMiningDifficulty)
 
 	ctx, _ := context.WithTimeout(context.Background(), 3*time.Second)
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"net/http"
 
 	"github.com/andrewyang17/goBlockchain/database"
@@ -16,7 +17,22 @@ type ErrRes struct {
 
 type BalancesRes struct {
 	Hash     database.Hash           `json:"block_hash"`
+	Number   uint64                  `json:"block_number"`
 	Balances map[common.Address]uint `json:"balances"`
+
+	// Balances split into the spendable ones and the block rewards locked until the coinbase maturity
+	Spendable map[common.Address]uint `json:"spendable_balances"`
+	Immature  map[common.Address]uint `json:"immature_balances"`
+}
+
+type BalanceRes struct {
+	Hash      database.Hash  `json:"block_hash"`
+	Number    uint64         `json:"block_number"`
+	Account   common.Address `json:"account"`
+	Balance   uint           `json:"balance"`
+	Spendable uint           `json:"spendable_balance"`
+	Immature  uint           `json:"immature_balance"`
+	Nonce     uint           `json:"nonce"`
 }
 
 type TxAddReq struct {
@@ -27,17 +43,43 @@ type TxAddReq struct {
 	GasPrice uint   `json:"gasPrice"`
 	Value    uint   `json:"value"`
 	Data     string `json:"data"`
+
+	// MaxFee and Tip per gas replace the GasPrice since TIP11 fork
+	MaxFee uint `json:"maxFee"`
+	Tip    uint `json:"tip"`
 }
 
 type TxAddRes struct {
 	Success bool `json:"success"`
 }
 
+type TxRes struct {
+	Tx            database.SignedTx    `json:"tx"`
+	Block         *database.TxLocation `json:"block,omitempty"`
+	Confirmations uint64               `json:"confirmations"`
+	Pending       bool                 `json:"pending"`
+}
+
+type AddressTxsRes struct {
+	Account common.Address       `json:"account"`
+	Txs     []database.AddressTx `json:"txs"`
+	Total   int                  `json:"total"`
+	Offset  int                  `json:"offset"`
+	Limit   int                  `json:"limit"`
+}
+
 type StatusRes struct {
-	Hash       database.Hash       `json:"block_hash"`
-	Number     uint64              `json:"block_number"`
-	KnownPeers map[string]PeerNode `json:"peers_known"`
-	PendingTxs []database.SignedTx `json:"pending_txs"`
+	Hash        database.Hash       `json:"block_hash"`
+	Number      uint64              `json:"block_number"`
+	GenesisHash database.Hash       `json:"genesis_hash"`
+	ChainWork   *big.Int            `json:"chain_work"`
+	KnownPeers  map[string]PeerNode `json:"peers_known"`
+	PendingTxs  []database.SignedTx `json:"pending_txs"`
+}
+
+type ForksRes struct {
+	NextNumber uint64                `json:"next_block_number"`
+	Forks      []database.ForkStatus `json:"forks"`
 }
 
 type SyncRes struct {
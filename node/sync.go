@@ -2,8 +2,11 @@ package node
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/andrewyang17/goBlockchain/database"
@@ -24,6 +27,8 @@ func (n *Node) sync(ctx context.Context) error {
 }
 
 func (n *Node) doSync() {
+	n.importDeferredBlocks()
+
 	for _, peer := range n.knownPeers {
 		if n.info.IP == peer.IP && n.info.Port == peer.Port {
 			continue
@@ -43,6 +48,14 @@ func (n *Node) doSync() {
 			continue
 		}
 
+		// A peer of a different chain must not feed us its blocks, peers and TXs
+		if status.GenesisHash != n.state.GenesisHash() {
+			fmt.Printf("ERROR: Peer '%s' runs genesis '%x', not '%x'\n", peer.TcpAddress(), status.GenesisHash, n.state.GenesisHash())
+			fmt.Printf("Peer '%s' was removed from knownPeers\n", peer.TcpAddress())
+			n.RemovePeer(peer)
+			continue
+		}
+
 		err = n.joinKnownPeers(peer)
 		if err != nil {
 			fmt.Printf("ERROR: %s\n", err)
@@ -77,31 +90,45 @@ func (n *Node) syncBlocks(peer PeerNode, status StatusRes) error {
 		return nil
 	}
 
-	// If the peer has no blocks, ignore it
-	if status.Number < localBlockNumber {
+	// If the peer's chain has no more work than ours, ignore it. Peers not reporting
+	// the chain work are compared by their number of blocks.
+	if status.ChainWork != nil && status.ChainWork.Cmp(n.state.ChainWork()) <= 0 {
 		return nil
 	}
 
-	// If it's the genesis block, and we already synced it, ignore it
-	if status.Number == 0 && !n.state.LatestBlockHash().IsEmpty() {
+	if status.ChainWork == nil && status.Number < localBlockNumber {
 		return nil
 	}
 
-	// Display found 1 new block if we sync the genesis block 0
-	newBlocksCount := status.Number - localBlockNumber
+	// If we already know the peer's latest block, ignore it
+	if n.state.IsKnownBlock(status.Hash) {
+		return nil
+	}
+
+	// Display found 1 new block if we sync the genesis block 0. A heavier chain may be shorter.
+	newBlocksCount := uint64(0)
+	if status.Number > localBlockNumber {
+		newBlocksCount = status.Number - localBlockNumber
+	}
 	if localBlockNumber == 0 && status.Number == 0 {
 		newBlocksCount = 1
 	}
 
 	fmt.Printf("Found %d new blocks from Peer %s\n", newBlocksCount, peer.TcpAddress())
 
-	blocks, err := fetchBlocksFromPeer(peer, n.state.LatestBlockHash())
+	blocks, err := fetchBlocksFromPeer(peer, n.state.BlockLocator())
 	if err != nil {
 		return err
 	}
 
-	for _, block := range blocks {
+	for i, block := range blocks {
 		err = n.addBlock(block)
+		if errors.Is(err, database.ErrFutureBlock) {
+			// The peer's clock may be ahead, the block and its descendants wait for ours instead of being dropped
+			fmt.Printf("Deferring %d blocks from Peer %s: %s\n", len(blocks)-i, peer.TcpAddress(), err)
+			n.deferBlocks(blocks[i:])
+			return nil
+		}
 		if err != nil {
 			return err
 		}
@@ -112,6 +139,61 @@ func (n *Node) syncBlocks(peer PeerNode, status StatusRes) error {
 	return nil
 }
 
+// deferBlocks keeps the blocks until the node time allows importing them, up to maxDeferredBlocks.
+func (n *Node) deferBlocks(blocks []database.Block) {
+	for _, block := range blocks {
+		if len(n.deferredBlocks) >= maxDeferredBlocks {
+			return
+		}
+
+		hash, err := block.Hash()
+		if err != nil {
+			continue
+		}
+
+		n.deferredBlocks[hash] = block
+	}
+}
+
+// importDeferredBlocks imports the deferred blocks no longer too far in the future, by height.
+// Blocks still in the future stay deferred, invalid ones are dropped.
+func (n *Node) importDeferredBlocks() {
+	blocks := make([]database.Block, 0, len(n.deferredBlocks))
+	for _, block := range n.deferredBlocks {
+		blocks = append(blocks, block)
+	}
+
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].Header.Number < blocks[j].Header.Number
+	})
+
+	for _, block := range blocks {
+		hash, err := block.Hash()
+		if err != nil {
+			continue
+		}
+
+		if n.state.IsKnownBlock(hash) {
+			delete(n.deferredBlocks, hash)
+			continue
+		}
+
+		err = n.addBlock(block)
+		if errors.Is(err, database.ErrFutureBlock) {
+			continue
+		}
+
+		delete(n.deferredBlocks, hash)
+
+		if err != nil {
+			fmt.Printf("ERROR: dropping deferred block '%s': %s\n", hash.Hex(), err)
+			continue
+		}
+
+		n.newSyncedBlocks <- block
+	}
+}
+
 func (n *Node) syncKnownPeers(status StatusRes) error {
 	for _, statusPeer := range status.KnownPeers {
 		if !n.IsKnownPeer(statusPeer) {
@@ -193,15 +275,20 @@ func queryPeerStatus(peer PeerNode) (StatusRes, error) {
 	return sr, nil
 }
 
-func fetchBlocksFromPeer(peer PeerNode, fromBlock database.Hash) ([]database.Block, error) {
+func fetchBlocksFromPeer(peer PeerNode, locator []database.Hash) ([]database.Block, error) {
 	fmt.Printf("Importing blocks from Peer %s...\n", peer.TcpAddress())
 
+	fromBlocks := make([]string, len(locator))
+	for i, hash := range locator {
+		fromBlocks[i] = hash.Hex()
+	}
+
 	url := fmt.Sprintf(
 		"http://%s%s?%s=%s",
 		peer.TcpAddress(),
 		endpointSync,
 		endpointSyncQueryKeyFromBlock,
-		fromBlock.Hex(),
+		strings.Join(fromBlocks, ","),
 	)
 
 	res, err := http.Get(url)